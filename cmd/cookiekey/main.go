@@ -0,0 +1,93 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command cookiekey generates a cookie signing key for a cookie.KeyRing.
+//
+// Usage:
+//
+//	cookiekey [-id id] [-size n] [-not-before time] [-valid duration] [-format pem|json]
+//
+// The key is written to standard output. PEM keys can be appended to an
+// existing PEM key file:
+//
+//	cookiekey -not-before 168h -valid 8760h >> keys.pem
+//
+// The -not-before flag is an RFC 3339 time or a duration from now. The key
+// expires after the -valid duration from the not-before time or now.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/garyburd/web/cookie"
+)
+
+var (
+	id        = flag.String("id", "", "key ID, default is the current date and time")
+	size      = flag.Int("size", 32, "secret size in bytes")
+	notBefore = flag.String("not-before", "", "time that the key is valid for signing, RFC 3339 time or duration from now")
+	valid     = flag.Duration("valid", 0, "duration that the key is valid, zero for no expiration")
+	format    = flag.String("format", "pem", "output format, pem or json")
+)
+
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(d).Truncate(time.Second), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("cookiekey: ")
+	flag.Parse()
+
+	now := time.Now().UTC()
+	keyID := *id
+	if keyID == "" {
+		keyID = now.Format("20060102T150405")
+	}
+	k, err := cookie.GenerateKey(keyID, *size)
+	if err != nil {
+		log.Fatal(err)
+	}
+	k.NotBefore, err = parseTime(*notBefore, now)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *valid != 0 {
+		start := k.NotBefore
+		if start.IsZero() {
+			start = now.Truncate(time.Second)
+		}
+		k.NotAfter = start.Add(*valid)
+	}
+	// Check the key.
+	if _, err := cookie.NewKeyRing(k); err != nil {
+		log.Fatal(err)
+	}
+
+	switch *format {
+	case "pem":
+		err = cookie.WriteKeyPEM(os.Stdout, k)
+	case "json":
+		var p []byte
+		p, err = cookie.MarshalKeysJSON(k)
+		if err == nil {
+			_, err = fmt.Printf("%s\n", p)
+		}
+	default:
+		log.Fatalf("unknown format %q", *format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
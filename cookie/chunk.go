@@ -0,0 +1,130 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxCookieSize is the maximum size of a Set-Cookie header value accepted by
+// browsers.
+const maxCookieSize = 4096
+
+// WithChunking enables splitting values that exceed the browser limit of 4096
+// bytes across cookies named name.0, name.1 and so on. The signature or
+// encryption covers the complete value. The budget is the maximum total size
+// in bytes of the Set-Cookie header values for the chunks. Encode returns
+// ErrTooLarge if the value does not fit in the budget.
+//
+// Because the codec does not know which chunks the browser has, Encode
+// deletes chunks that are not used by the value up to the maximum number of
+// chunks allowed by the budget.
+func WithChunking(budget int) Option {
+	return Option{func(cc *Codec) { cc.chunkBudget = budget }}
+}
+
+// maxChunks returns the maximum number of chunks allowed by the budget.
+func (cc *Codec) maxChunks() int {
+	return (cc.chunkBudget + maxCookieSize - 1) / maxCookieSize
+}
+
+func (cc *Codec) chunkName(i int) string {
+	return cc.name + "." + strconv.Itoa(i)
+}
+
+// encodeChunks writes the value v as chunks. The value of the first chunk is
+// prefixed with the number of chunks and ':'.
+func (cc *Codec) encodeChunks(w http.ResponseWriter, v []byte, attrs string, remove bool) error {
+	maxChunks := cc.maxChunks()
+	n := 0
+	if !remove {
+		// Reserve space for the largest index and the count prefix.
+		digits := len(strconv.Itoa(maxChunks))
+		size := maxCookieSize - len(cc.name) - len(".=:") - 2*digits - len(attrs)
+		if size <= 0 {
+			return ErrTooLarge
+		}
+		n = (len(v) + size - 1) / size
+		if n > maxChunks {
+			return ErrTooLarge
+		}
+		var headers []string
+		total := 0
+		for i := 0; i < n; i++ {
+			chunk := v[i*size:]
+			if len(chunk) > size {
+				chunk = chunk[:size]
+			}
+			var prefix string
+			if i == 0 {
+				prefix = strconv.Itoa(n) + ":"
+			}
+			h := cc.chunkName(i) + "=" + prefix + string(chunk) + attrs
+			total += len(h)
+			headers = append(headers, h)
+		}
+		if total > cc.chunkBudget {
+			return ErrTooLarge
+		}
+		for _, h := range headers {
+			w.Header().Add("Set-Cookie", h)
+		}
+	}
+	if n < maxChunks {
+		deleteAttrs := cc.attributes(deleteMaxAge)
+		for i := n; i < maxChunks; i++ {
+			w.Header().Add("Set-Cookie", cc.chunkName(i)+"=."+deleteAttrs)
+		}
+	}
+	return nil
+}
+
+// findChunks returns the value assembled from the chunks in the request. If
+// the request has more than one cookie for a chunk, then the first cookie is
+// used. If the chunks are not found or the assembled value is empty, then
+// findChunks returns false.
+func (cc *Codec) findChunks(r *http.Request) (string, bool) {
+	prefix := cc.name + "."
+	chunks := make(map[int]string)
+	parseCookies(r.Header, func(name, value string) {
+		if !strings.HasPrefix(name, prefix) {
+			return
+		}
+		i, err := strconv.Atoi(name[len(prefix):])
+		if err != nil || i < 0 {
+			return
+		}
+		if _, ok := chunks[i]; !ok {
+			chunks[i] = value
+		}
+	})
+	first, ok := chunks[0]
+	if !ok {
+		return "", false
+	}
+	i := strings.IndexByte(first, ':')
+	if i < 0 {
+		return "", false
+	}
+	n, err := strconv.Atoi(first[:i])
+	if err != nil || n < 1 || n > cc.maxChunks() {
+		return "", false
+	}
+	parts := []string{first[i+1:]}
+	for i := 1; i < n; i++ {
+		chunk, ok := chunks[i]
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, chunk)
+	}
+	s := strings.Join(parts, "")
+	if s == "" {
+		return "", false
+	}
+	return s, true
+}
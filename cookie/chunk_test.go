@@ -0,0 +1,136 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// jar stores cookies like a browser.
+type jar map[string]string
+
+func (j jar) update(t *testing.T, w *httptest.ResponseRecorder) {
+	for _, h := range w.Header()["Set-Cookie"] {
+		if len(h) > maxCookieSize {
+			t.Errorf("Set-Cookie header length %d exceeds %d", len(h), maxCookieSize)
+		}
+		nv := h
+		if i := strings.IndexByte(nv, ';'); i >= 0 {
+			nv = nv[:i]
+		}
+		i := strings.IndexByte(nv, '=')
+		if strings.Contains(h, "max-age=-") {
+			delete(j, nv[:i])
+		} else {
+			j[nv[:i]] = nv[i+1:]
+		}
+	}
+}
+
+func (j jar) request() *http.Request {
+	var names []string
+	for name := range j {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		pairs = append(pairs, name+"="+j[name])
+	}
+	return &http.Request{Header: http.Header{"Cookie": {strings.Join(pairs, "; ")}}}
+}
+
+func TestChunking(t *testing.T) {
+	hmacKeys := [][]byte{[]byte("key")}
+	large := strings.Repeat("abcdefghij", 1000)
+
+	codecs := []*Codec{
+		NewCodec("c", WithHMACKeys(hmacKeys), WithChunking(16*1024)),
+		NewCodec("c", WithEncryptionKeys([][]byte{[]byte("0123456789abcdef")}), WithChunking(16*1024)),
+	}
+	for _, codec := range codecs {
+		j := jar{}
+
+		w := httptest.NewRecorder()
+		if err := codec.Encode(w, large); err != nil {
+			t.Fatalf("Encode(large) returned %v", err)
+		}
+		j.update(t, w)
+		if len(j) < 3 {
+			t.Errorf("large value stored in %d chunks, want at least 3", len(j))
+		}
+		var s string
+		if err := codec.Decode(j.request(), &s); err != nil || s != large {
+			t.Errorf("Decode(large) returned %v", err)
+		}
+
+		// Tampering with a chunk invalidates the value.
+		j2 := jar{}
+		for k, v := range j {
+			j2[k] = v
+		}
+		j2["c.1"] = strings.Replace(j2["c.1"], "a", "b", 1)
+		if err := codec.Decode(j2.request(), &s); err == nil {
+			t.Error("Decode of tampered chunk did not return error")
+		}
+
+		// Stale chunks are deleted when the value shrinks.
+		w = httptest.NewRecorder()
+		if err := codec.Encode(w, "small"); err != nil {
+			t.Fatalf("Encode(small) returned %v", err)
+		}
+		j.update(t, w)
+		if len(j) != 1 {
+			t.Errorf("small value stored in %d chunks, want 1: %v", len(j), j)
+		}
+		if err := codec.Decode(j.request(), &s); err != nil || s != "small" {
+			t.Errorf("Decode(small) = %q, %v, want small", s, err)
+		}
+
+		// Encode with no values deletes all chunks.
+		w = httptest.NewRecorder()
+		codec.Encode(w)
+		j.update(t, w)
+		if len(j) != 0 {
+			t.Errorf("chunks remain after delete: %v", j)
+		}
+
+		w = httptest.NewRecorder()
+		if err := codec.Encode(w, large+large); err != ErrTooLarge {
+			t.Errorf("Encode(large+large) returned %v, want ErrTooLarge", err)
+		}
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	codec := NewCodec("c", WithHMACKeys([][]byte{[]byte("key")}))
+	w := httptest.NewRecorder()
+	if err := codec.Encode(w, strings.Repeat("x", maxCookieSize)); err != ErrTooLarge {
+		t.Errorf("Encode returned %v, want ErrTooLarge", err)
+	}
+	if h := w.Header().Get("Set-Cookie"); h != "" {
+		t.Errorf("Encode wrote header for value that is too large")
+	}
+}
+
+var emptyChunkTests = []string{
+	"c.0=1:",
+	"c.0=2:; c.1=",
+	"c.0=1:; c=",
+}
+
+func TestEmptyChunk(t *testing.T) {
+	codec := NewCodec("c", WithEncryptionKeys([][]byte{[]byte("0123456789abcdef")}), WithChunking(8192))
+	for _, c := range emptyChunkTests {
+		var s string
+		if err := codec.Decode(requestWithCookie(c), &s); err == nil {
+			t.Errorf("Decode(%q) did not return error", c)
+		}
+	}
+}
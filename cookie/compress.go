@@ -0,0 +1,96 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// compressedFlag follows the time in a signed or encrypted value when the
+// values are compressed.
+const compressedFlag = "!z"
+
+// WithCompression compresses the encoded values with deflate when compression
+// reduces the size of the cookie. The values are compressed before signing or
+// encryption. Decode rejects values that decompress to more than maxSize
+// bytes. Compression requires signing or encryption keys.
+//
+// Do not compress encrypted values that contain both secrets and data
+// controlled by an attacker. The size of the compressed value can reveal the
+// secret.
+func WithCompression(maxSize int) Option {
+	return Option{func(cc *Codec) { cc.maxDecompressedSize = maxSize }}
+}
+
+// timeValues returns the time and encoded values for a signed or encrypted
+// value. If raw is true, then compressed values are not base64url encoded.
+func (cc *Codec) timeValues(issued, created time.Time, values []interface{}, raw bool) ([]byte, error) {
+	v, err := encodeValues(nil, values)
+	if err != nil {
+		return nil, err
+	}
+	tv := appendTime(nil, issued, created)
+	if cc.maxDecompressedSize > 0 && len(v) <= cc.maxDecompressedSize {
+		z, err := compress(v, raw)
+		if err != nil {
+			return nil, err
+		}
+		if len(z)+len(compressedFlag) < len(v) {
+			tv = append(tv, compressedFlag...)
+			tv = append(tv, '|')
+			return append(tv, z...), nil
+		}
+	}
+	tv = append(tv, '|')
+	return append(tv, v...), nil
+}
+
+func compress(p []byte, raw bool) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	w.Write(p)
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if raw {
+		return buf.Bytes(), nil
+	}
+	z := make([]byte, base64Encoding.EncodedLen(buf.Len()))
+	base64Encoding.Encode(z, buf.Bytes())
+	return z, nil
+}
+
+// decompress decompresses the values in s. If raw is false, then the
+// compressed values are base64url encoded.
+func (cc *Codec) decompress(s string, raw bool) (string, error) {
+	if cc.maxDecompressedSize <= 0 {
+		return "", cc.decodeError(ErrMalformed, "compression not enabled")
+	}
+	if !raw {
+		p, err := base64Encoding.DecodeString(s)
+		if err != nil {
+			return "", cc.decodeError(ErrMalformed, "bad value format")
+		}
+		s = string(p)
+	}
+	r := flate.NewReader(strings.NewReader(s))
+	defer r.Close()
+	p, err := ioutil.ReadAll(io.LimitReader(r, int64(cc.maxDecompressedSize)+1))
+	if err != nil {
+		return "", cc.decodeError(ErrMalformed, "bad compressed value")
+	}
+	if len(p) > cc.maxDecompressedSize {
+		return "", cc.decodeError(ErrMalformed, "decompressed value too large")
+	}
+	return string(p), nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompression(t *testing.T) {
+	t0 := time.Unix(1136214245, 0)
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+
+	ids := make([]int64, 400)
+	for i := range ids {
+		ids[i] = 1000000 + int64(i)
+	}
+
+	for _, keys := range []Option{
+		WithHMACKeys([][]byte{[]byte("key")}),
+		WithEncryptionKeys([][]byte{[]byte("0123456789abcdef")}),
+	} {
+		plain := NewCodec("cart", keys)
+		cc := NewCodec("cart", keys, WithCompression(1<<16))
+
+		s1, err := plain.NewCookie(ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s2, err := cc.NewCookie(ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s2.Value) >= len(s1.Value)/2 {
+			t.Errorf("compressed size %d, uncompressed size %d", len(s2.Value), len(s1.Value))
+		}
+
+		var got []int64
+		if err := cc.DecodeCookie(s2, &got); err != nil || !reflect.DeepEqual(got, ids) {
+			t.Errorf("DecodeCookie(compressed) = %v, %v", got, err)
+		}
+
+		// Uncompressed values are accepted and small values are not compressed.
+		got = nil
+		if err := cc.DecodeCookie(s1, &got); err != nil || !reflect.DeepEqual(got, ids) {
+			t.Errorf("DecodeCookie(uncompressed) = %v, %v", got, err)
+		}
+		small, _ := cc.NewCookie("a")
+		if small2, _ := plain.NewCookie("a"); len(small.Value) != len(small2.Value) {
+			t.Errorf("small value compressed: %q", small.Value)
+		}
+
+		// A codec without compression rejects compressed values.
+		if err := plain.DecodeCookie(s2, &got); !errors.Is(err, ErrMalformed) {
+			t.Errorf("DecodeCookie(compressed) without compression returned %v", err)
+		}
+
+		// Values that decompress to more than the limit are rejected.
+		limited := NewCodec("cart", keys, WithCompression(100))
+		if err := limited.DecodeCookie(s2, &got); !errors.Is(err, ErrMalformed) {
+			t.Errorf("DecodeCookie(too large) returned %v", err)
+		}
+	}
+}
+
+func TestDecompressBomb(t *testing.T) {
+	cc := NewCodec("c", WithHMACKeys([][]byte{[]byte("key")}), WithCompression(1024))
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w.Write(bytes.Repeat([]byte("a"), 1<<24))
+	w.Close()
+	tv := strconv.FormatInt(time.Now().Unix(), 36) + compressedFlag + "|" + base64Encoding.EncodeToString(buf.Bytes())
+	sig, _ := cc.sign(nil, []byte(tv))
+	var s string
+	err := cc.DecodeString(string(sig)+"|"+tv, &s)
+	if !errors.Is(err, ErrMalformed) || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("DecodeString(bomb) returned %v", err)
+	}
+}
+
+func TestInvalidCompression(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("NewCodec did not panic for compression without keys")
+		}
+	}()
+	NewCodec("c", WithCompression(1024))
+}
@@ -5,21 +5,39 @@
 // Package cookie provides a codec for encoding and decoding values to HTTP
 // cookies.
 //
-// The codec supports values of type int, string and []string.
+// The codec supports values of type string, bool, integer, float, []byte,
+// time.Time, time.Duration, encoding.TextMarshaler, slices, arrays, maps with
+// string keys and structs. Struct fields are encoded using the name from the
+// "cookie" field tag if present. The tag option "omitempty" omits empty
+// values and the tag "-" skips the field. Fields not present in a decoded
+// value are left unchanged.
+//
+// The codec optionally signs values with HMAC or encrypts values with an
+// authenticated encryption cipher. Signed values have the format
+//
+//	2.[keyid.]mac|time|values
+//
+// where 2 is the format version, keyid is the ID of the key ring key, mac is
+// the base64url encoded HMAC-SHA256 and time is the base 36 issue time in
+// Unix seconds. The time is followed by !z when the values are compressed
+// with deflate. Encrypted values are '~' followed by the base64url encoded
+// nonce and ciphertext. See WithJWS for the alternate JWS format.
 package cookie // import "github.com/garyburd/web/cookie"
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
-	"fmt"
 	"hash"
 	"io"
 	"net/http"
-	"net/url"
-	"reflect"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -41,137 +59,556 @@ func isValidCookieName(s string) bool {
 
 // Codec encodes and decodes cookies.
 type Codec struct {
-	name     string
-	value    string
-	path     string
-	domain   string
-	maxAge   time.Duration
-	secure   bool
-	httpOnly bool
-	hashFunc func() hash.Hash
-	hmacKeys [][]byte
-	re       *regexp.Regexp
+	name                string
+	value               string
+	path                string
+	domain              string
+	maxAge              time.Duration
+	secure              bool
+	httpOnly            bool
+	sameSite            http.SameSite
+	partitioned         bool
+	hashFunc            func() hash.Hash
+	hmacKeys            [][]byte
+	keyRing             *KeyRing
+	legacyUntil         *time.Time
+	legacyHashFunc      func() hash.Hash
+	refresh             float64
+	absoluteLifetime    time.Duration
+	tamperHook          func(err *DecodeError)
+	encKeys             [][]byte
+	newAEAD             func(key []byte) (cipher.AEAD, error)
+	aeads               []cipher.AEAD
+	chunkBudget         int
+	maxDecompressedSize int
+	jwsAlg              string
+	jwsHash             func() hash.Hash
 }
 
 type Option struct{ f func(*Codec) }
 
-// NewCodec creates a new codec with the given options.
+// NewCodec creates a new codec with the given options. NewCodec panics if the
+// name or attributes are not valid. Names with the __Secure- prefix require
+// the secure attribute. Names with the __Host- prefix require the secure
+// attribute, path "/" and no domain.
 func NewCodec(name string, options ...Option) *Codec {
 	if !isValidCookieName(name) {
 		panic(name + " is not a valid cookie name")
 	}
+	return newCodec(name, options)
+}
+
+// Rename returns a copy of the codec with the given cookie name. The copy
+// shares the keys and options of the codec without parsing the options
+// again. Rename panics if the name is not valid or the name prefix requires
+// attributes that the codec does not have.
+func (cc *Codec) Rename(name string) *Codec {
+	if !isValidCookieName(name) {
+		panic(name + " is not a valid cookie name")
+	}
+	c := *cc
+	c.name = name
+	if err := c.checkAttributes(); err != nil {
+		panic(err.Error())
+	}
+	return &c
+}
+
+func newCodec(name string, options []Option) *Codec {
 	cc := &Codec{
-		name:     name,
-		path:     "/",
-		httpOnly: true,
-		hashFunc: sha1.New,
-		re:       regexp.MustCompile(`(?:; |^)` + regexp.QuoteMeta(name) + `="?([^ ",;\\]+)`),
+		name:           name,
+		path:           "/",
+		httpOnly:       true,
+		hashFunc:       sha256.New,
+		legacyHashFunc: sha1.New,
+		newAEAD:        newGCM,
 	}
 	for _, option := range options {
 		option.f(cc)
 	}
+	if err := cc.checkAttributes(); err != nil {
+		panic(err.Error())
+	}
+	for _, key := range cc.encKeys {
+		aead, err := cc.newAEAD(key)
+		if err != nil {
+			panic("cookie: " + err.Error())
+		}
+		cc.aeads = append(cc.aeads, aead)
+	}
 	return cc
 }
 
-func (cc *Codec) sign(i int, tv []byte) []byte {
-	h := hmac.New(cc.hashFunc, cc.hmacKeys[i])
+func isValidAttributeValue(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if b := s[i]; b < ' ' || b == 127 || b == ';' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkAttributes checks the cookie attributes against the rules in RFC
+// 6265bis and checks the lifetime options.
+func (cc *Codec) checkAttributes() error {
+	switch {
+	case cc.path != "" && cc.path[0] != '/':
+		return errors.New("cookie: path must start with '/'")
+	case !isValidAttributeValue(cc.path):
+		return errors.New("cookie: invalid path " + cc.path)
+	case !isValidAttributeValue(cc.domain):
+		return errors.New("cookie: invalid domain " + cc.domain)
+	case cc.sameSite == http.SameSiteNoneMode && !cc.secure:
+		return errors.New("cookie: SameSite=None requires the secure attribute")
+	case cc.partitioned && !cc.secure:
+		return errors.New("cookie: partitioned cookies require the secure attribute")
+	case cc.refresh < 0 || cc.refresh >= 1 || cc.refresh > 0 && cc.maxAge <= 0:
+		return errors.New("cookie: refresh requires a fraction between 0 and 1 and a maximum age")
+	case cc.absoluteLifetime < 0:
+		return errors.New("cookie: absolute lifetime must not be negative")
+	case cc.maxDecompressedSize < 0 || cc.maxDecompressedSize > 0 && cc.hmacKeys == nil && cc.keyRing == nil && cc.encKeys == nil:
+		return errors.New("cookie: compression requires a positive maximum size and signing or encryption keys")
+	}
+	lname := strings.ToLower(cc.name)
+	switch {
+	case strings.HasPrefix(lname, "__secure-"):
+		if !cc.secure {
+			return errors.New("cookie: __Secure- prefix requires the secure attribute")
+		}
+	case strings.HasPrefix(lname, "__host-"):
+		if !cc.secure {
+			return errors.New("cookie: __Host- prefix requires the secure attribute")
+		}
+		if cc.domain != "" {
+			return errors.New("cookie: __Host- prefix does not allow the domain attribute")
+		}
+		if cc.path != "/" {
+			return errors.New("cookie: __Host- prefix requires path /")
+		}
+	}
+	return cc.checkJWS()
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedPrefix marks an encrypted cookie value. The prefix does not appear
+// at the start of signed values because signed values start with signedPrefix
+// or, in the legacy format, a hex encoded signature.
+const encryptedPrefix = '~'
+
+var base64Encoding = base64.RawURLEncoding
+
+// seal encrypts tv with the first key. The cookie name is authenticated as
+// additional data.
+func (cc *Codec) seal(buf []byte, tv []byte) ([]byte, error) {
+	aead := cc.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(tv)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, tv, []byte(cc.name))
+	buf = append(buf, encryptedPrefix)
+	n := len(buf)
+	buf = append(buf, make([]byte, base64Encoding.EncodedLen(len(sealed)))...)
+	base64Encoding.Encode(buf[n:], sealed)
+	return buf, nil
+}
+
+// open decrypts a value created by seal.
+func (cc *Codec) open(s string) (string, error) {
+	sealed, err := base64Encoding.DecodeString(s[1:])
+	if err != nil {
+		return "", cc.decodeError(ErrMalformed, "bad value format")
+	}
+	for _, aead := range cc.aeads {
+		if len(sealed) < aead.NonceSize() {
+			continue
+		}
+		tv, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(cc.name))
+		if err == nil {
+			return string(tv), nil
+		}
+	}
+	return "", cc.decodeError(ErrInvalid, "decryption failed")
+}
+
+// signedPrefix marks a signed value in the current format. The signature
+// has the format 2.[id.]mac where id is the key ID when the codec uses a key
+// ring and mac is the base64url encoded HMAC. Signatures in the legacy format
+// are hex encoded and do not include the version.
+const signedPrefix = "2."
+
+// mac returns the base64url encoded HMAC of the cookie name, key ID and tv.
+func (cc *Codec) mac(key []byte, id string, tv []byte) []byte {
+	h := hmac.New(cc.hashFunc, key)
 	io.WriteString(h, cc.name)
+	io.WriteString(h, "|2|")
+	io.WriteString(h, id)
 	io.WriteString(h, "|")
 	h.Write(tv)
 	sum := h.Sum(nil)
-	buf := make([]byte, hex.EncodedLen(len(sum)))
-	hex.Encode(buf, sum)
+	buf := make([]byte, base64Encoding.EncodedLen(len(sum)))
+	base64Encoding.Encode(buf, sum)
 	return buf
 }
 
-func (cc *Codec) validate(v string, h string) bool {
+// sign appends the signature for tv to buf.
+func (cc *Codec) sign(buf []byte, tv []byte) ([]byte, error) {
+	buf = append(buf, signedPrefix...)
+	if cc.keyRing != nil {
+		k := cc.keyRing.signingKey(now())
+		if k == nil {
+			return nil, errors.New("cookie: no valid signing key")
+		}
+		buf = append(buf, k.ID...)
+		buf = append(buf, '.')
+		return append(buf, cc.mac(k.Secret, k.ID, tv)...), nil
+	}
+	return append(buf, cc.mac(cc.hmacKeys[0], "", tv)...), nil
+}
+
+// validate validates the signature h for the value v in the current format.
+func (cc *Codec) validate(v string, h string) error {
 	bv := []byte(v)
+	if i := strings.IndexByte(h, '.'); i >= 0 {
+		if cc.keyRing == nil {
+			return cc.decodeError(ErrMalformed, "bad value format")
+		}
+		k := cc.keyRing.verificationKey(h[:i], now())
+		if k == nil {
+			return cc.decodeError(ErrInvalid, "unknown or expired key")
+		}
+		if !hmac.Equal(cc.mac(k.Secret, k.ID, bv), []byte(h[i+1:])) {
+			return cc.decodeError(ErrInvalid, "bad HMAC")
+		}
+		return nil
+	}
+	for _, key := range cc.hmacKeys {
+		if hmac.Equal(cc.mac(key, "", bv), []byte(h)) {
+			return nil
+		}
+	}
+	return cc.decodeError(ErrInvalid, "bad HMAC")
+}
+
+// validateLegacy validates the signature h for the value v in the legacy
+// format.
+func (cc *Codec) validateLegacy(v string, h string) error {
+	if cc.legacyUntil != nil && !now().Before(*cc.legacyUntil) {
+		return cc.decodeError(ErrExpired, "legacy format not accepted")
+	}
 	bh := []byte(h)
-	for i := range cc.hmacKeys {
-		if hmac.Equal(cc.sign(i, bv), bh) {
-			return true
+	for _, key := range cc.hmacKeys {
+		m := hmac.New(cc.legacyHashFunc, key)
+		io.WriteString(m, cc.name)
+		io.WriteString(m, "|")
+		io.WriteString(m, v)
+		sum := m.Sum(nil)
+		buf := make([]byte, hex.EncodedLen(len(sum)))
+		hex.Encode(buf, sum)
+		if hmac.Equal(buf, bh) {
+			return nil
 		}
 	}
-	return false
+	return cc.decodeError(ErrInvalid, "bad HMAC")
 }
 
-// Decode decodes a cookie value from a request.
+// Decode decodes a cookie value from a request. If the request has more than
+// one cookie with the codec's name, then Decode uses the first cookie that
+// passes the signature, decryption and expiration checks.
 func (cc *Codec) Decode(r *http.Request, values ...interface{}) error {
-	s := ""
-	for _, h := range r.Header["Cookie"] {
-		if m := cc.re.FindStringSubmatch(h); m != nil {
-			s = m[1]
-			break
-		}
+	_, err := cc.decode(r, values)
+	return err
+}
+
+// DecodeTime decodes a cookie value from a request and returns the time that
+// the value was issued. The issue time is zero for values that are not
+// signed or encrypted.
+func (cc *Codec) DecodeTime(r *http.Request, values ...interface{}) (time.Time, error) {
+	d, err := cc.decode(r, values)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return d.issued, nil
+}
+
+// DecodeAndReissue decodes a cookie value from a request and encodes the
+// values to a set cookie header if the value is signed in the legacy format
+// or the value is due for refresh as specified by WithRefresh. Refreshed
+// values keep the creation time of the original value so that refreshes do
+// not extend the absolute lifetime. Call DecodeAndReissue before writing the
+// response body.
+func (cc *Codec) DecodeAndReissue(w http.ResponseWriter, r *http.Request, values ...interface{}) error {
+	d, err := cc.decode(r, values)
+	if err != nil {
+		return err
 	}
-	if s == "" {
-		return errors.New("cookie: cookie not found")
+	refresh := cc.refresh > 0 && !d.issued.IsZero() &&
+		now().Sub(d.issued) >= time.Duration(float64(cc.maxAge)*cc.refresh)
+	if !d.legacy && !refresh {
+		return nil
 	}
+	return cc.encode(w, d.created, values)
+}
 
-	if cc.hmacKeys != nil {
-		var p string
+// decoded is a verified cookie value.
+type decoded struct {
+	values  string                     // encoded values
+	claims  map[string]json.RawMessage // JWS claims
+	legacy  bool                       // value is in the legacy format
+	issued  time.Time                  // time that the value was issued
+	created time.Time                  // time that the first value in a series of refreshes was issued
+}
 
-		// Check HMAC
+func (cc *Codec) decode(r *http.Request, values []interface{}) (*decoded, error) {
+	return cc.decodeCandidates(cc.Candidates(r), values)
+}
 
-		p, s = split(s)
-		if p == "" {
-			return errors.New("cookie: bad value format")
+// decodeCandidates decodes the first valid value in candidates.
+func (cc *Codec) decodeCandidates(candidates []string, values []interface{}) (*decoded, error) {
+	if len(candidates) == 0 {
+		return nil, cc.decodeError(ErrNotFound, "cookie not found")
+	}
+	var errs []error
+	for _, s := range candidates {
+		d, err := cc.verify(s)
+		if err == nil {
+			if d.claims != nil {
+				err = decodeClaims(d.claims, values)
+			} else {
+				err = decodeValues(d.values, values)
+			}
+			if err != nil {
+				return nil, cc.decodeError(ErrMalformed, strings.TrimPrefix(err.Error(), "cookie: "))
+			}
+			return d, nil
 		}
-
-		if !cc.validate(s, p) {
-			return errors.New("cookie: bad HMAC")
+		errs = append(errs, err)
+	}
+	if cc.tamperHook != nil {
+		for _, err := range errs {
+			if e, ok := err.(*DecodeError); ok && (e.Reason == ErrInvalid || e.Reason == ErrMalformed) {
+				cc.tamperHook(e)
+			}
 		}
+	}
+	return nil, errs[0]
+}
 
-		// Check expiration
-
-		p, s = split(s)
+// verify checks the signature or decrypts the cookie value s and checks the
+// expiration time.
+func (cc *Codec) verify(s string) (*decoded, error) {
+	switch {
+	case cc.jwsAlg != "":
+		return cc.verifyJWS(s)
+	case cc.aeads != nil && len(s) > 0 && s[0] == encryptedPrefix:
+		s, err := cc.open(s)
+		if err != nil {
+			return nil, err
+		}
+		return cc.checkTime(s, true)
+	case cc.hmacKeys != nil || cc.keyRing != nil:
+		// Check HMAC
+		p, s := split(s)
 		if p == "" {
-			return errors.New("cookie: bad value format")
+			return nil, cc.decodeError(ErrMalformed, "bad value format")
 		}
-
-		t, err := strconv.ParseInt(p, 36, 64)
+		legacy := !strings.HasPrefix(p, signedPrefix)
+		var err error
+		if legacy {
+			err = cc.validateLegacy(s, p)
+		} else {
+			err = cc.validate(s, p[len(signedPrefix):])
+		}
+		if err != nil {
+			return nil, err
+		}
+		d, err := cc.checkTime(s, false)
 		if err != nil {
-			return errors.New("cookie: bad time format")
+			return nil, err
 		}
+		d.legacy = legacy
+		return d, nil
+	case cc.aeads != nil:
+		return nil, cc.decodeError(ErrInvalid, "value not encrypted")
+	}
+	return &decoded{values: s}, nil
+}
+
+// checkTime checks the expiration time at the start of s. The time has the
+// format issued[.created][!z] where issued and created are base 36 Unix
+// times. If created is not present, then the value was created at the issue
+// time. The flag !z marks compressed values. If raw is true, then compressed
+// values are not base64url encoded.
+func (cc *Codec) checkTime(s string, raw bool) (*decoded, error) {
+	p, s := split(s)
+	if p == "" {
+		return nil, cc.decodeError(ErrMalformed, "bad value format")
+	}
+	compressed := strings.HasSuffix(p, compressedFlag)
+	if compressed {
+		p = p[:len(p)-len(compressedFlag)]
+	}
+
+	ps, pc := p, p
+	if i := strings.IndexByte(p, '.'); i >= 0 {
+		ps, pc = p[:i], p[i+1:]
+	}
+	issued, err := strconv.ParseInt(ps, 36, 64)
+	if err != nil {
+		return nil, cc.decodeError(ErrMalformed, "bad time format")
+	}
+	created, err := strconv.ParseInt(pc, 36, 64)
+	if err != nil {
+		return nil, cc.decodeError(ErrMalformed, "bad time format")
+	}
 
-		if cc.maxAge != 0 && time.Unix(t, 0).Add(cc.maxAge+time.Second).Before(now()) {
-			return errors.New("cookie: expired")
+	d := &decoded{values: s, issued: time.Unix(issued, 0), created: time.Unix(created, 0)}
+	if err := cc.checkExpiry(d); err != nil {
+		return nil, err
+	}
+	if compressed {
+		if d.values, err = cc.decompress(d.values, raw); err != nil {
+			return nil, err
 		}
 	}
+	return d, nil
+}
 
-	return decodeValues(s, values)
+// checkExpiry checks the issue and creation times against the maximum age and
+// absolute lifetime.
+func (cc *Codec) checkExpiry(d *decoded) error {
+	t := now()
+	if cc.maxAge != 0 && d.issued.Add(cc.maxAge+time.Second).Before(t) {
+		return cc.decodeError(ErrExpired, "expired")
+	}
+	if cc.absoluteLifetime != 0 && d.created.Add(cc.absoluteLifetime+time.Second).Before(t) {
+		return cc.decodeError(ErrExpired, "expired")
+	}
+	return nil
+}
+
+// appendTime appends the time for a signed or encrypted value to buf.
+func appendTime(buf []byte, issued, created time.Time) []byte {
+	buf = strconv.AppendInt(buf, issued.Unix(), 36)
+	if created.Unix() != issued.Unix() {
+		buf = append(buf, '.')
+		buf = strconv.AppendInt(buf, created.Unix(), 36)
+	}
+	return buf
 }
 
 // Encode encodes value to a set cookie header. If value is nil, then the
-// set cookie header is set to expire in the past.
+// set cookie header is set to expire in the past. Encode returns ErrTooLarge
+// if the header exceeds the browser limit of 4096 bytes and chunking is not
+// enabled.
 func (cc *Codec) Encode(w http.ResponseWriter, values ...interface{}) error {
+	return cc.encode(w, time.Time{}, values)
+}
 
+// encodeValue returns the cookie value for values. If created is zero, then
+// the value is created now.
+func (cc *Codec) encodeValue(created time.Time, values []interface{}) ([]byte, error) {
 	var buf []byte
 
-	buf = append(buf, cc.name...)
-	buf = append(buf, '=')
+	issued := now()
+	if created.IsZero() {
+		created = issued
+	}
 
 	switch {
 	case len(values) == 0:
 		buf = append(buf, '.')
-	case cc.hmacKeys == nil:
+	case cc.aeads != nil:
+		tv, err := cc.timeValues(issued, created, values, true)
+		if err != nil {
+			return nil, err
+		}
+		buf, err = cc.seal(buf, tv)
+		if err != nil {
+			return nil, err
+		}
+	case cc.jwsAlg != "":
+		var err error
+		buf, err = cc.encodeJWS(issued, created, values)
+		if err != nil {
+			return nil, err
+		}
+	case cc.hmacKeys == nil && cc.keyRing == nil:
 		var err error
 		buf, err = encodeValues(buf, values)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	default:
-		tv := strconv.AppendInt(nil, now().Unix(), 36)
-		tv = append(tv, '|')
-		var err error
-		tv, err = encodeValues(tv, values)
+		tv, err := cc.timeValues(issued, created, values, false)
+		if err != nil {
+			return nil, err
+		}
+		buf, err = cc.sign(buf, tv)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		buf = append(buf, cc.sign(0, tv)...)
 		buf = append(buf, '|')
 		buf = append(buf, tv...)
 	}
+	return buf, nil
+}
+
+// cookieMaxAge returns the max-age attribute for a value created at the
+// given time. The max-age is limited by the absolute lifetime.
+func (cc *Codec) cookieMaxAge(created time.Time, remove bool) time.Duration {
+	if remove {
+		return deleteMaxAge
+	}
+	maxAge := cc.maxAge
+	if cc.absoluteLifetime != 0 {
+		t := now()
+		if created.IsZero() {
+			created = t
+		}
+		remaining := created.Add(cc.absoluteLifetime).Sub(t)
+		if remaining < time.Second {
+			remaining = time.Second
+		}
+		if maxAge == 0 || remaining < maxAge {
+			maxAge = remaining
+		}
+	}
+	return maxAge
+}
+
+func (cc *Codec) encode(w http.ResponseWriter, created time.Time, values []interface{}) error {
+	buf, err := cc.encodeValue(created, values)
+	if err != nil {
+		return err
+	}
+
+	attrs := cc.attributes(cc.cookieMaxAge(created, len(values) == 0))
+
+	if cc.chunkBudget > 0 {
+		return cc.encodeChunks(w, buf, attrs, len(values) == 0)
+	}
+
+	if len(cc.name)+1+len(buf)+len(attrs) > maxCookieSize {
+		return ErrTooLarge
+	}
+	w.Header().Add("Set-Cookie", cc.name+"="+string(buf)+attrs)
+	return nil
+}
+
+// A time in the past deletes the cookie.
+const deleteMaxAge = -30 * 24 * time.Hour
+
+// attributes returns the cookie attributes for the Set-Cookie header.
+func (cc *Codec) attributes(maxAge time.Duration) string {
+	var buf []byte
 
 	if cc.path != "" {
 		buf = append(buf, "; path="...)
@@ -183,11 +620,6 @@ func (cc *Codec) Encode(w http.ResponseWriter, values ...interface{}) error {
 		buf = append(buf, cc.domain...)
 	}
 
-	maxAge := cc.maxAge
-	if len(values) == 0 {
-		// A time in the past deletes the cookie.
-		maxAge = -30 * 24 * time.Hour
-	}
 	if maxAge != 0 {
 		buf = append(buf, "; max-age="...)
 		buf = strconv.AppendInt(buf, int64(maxAge/time.Second), 10)
@@ -203,150 +635,24 @@ func (cc *Codec) Encode(w http.ResponseWriter, values ...interface{}) error {
 		buf = append(buf, "; HttpOnly"...)
 	}
 
-	w.Header().Add("Set-Cookie", string(buf))
-	return nil
-}
-
-func (cc *Codec) SetHMACKeys(keys [][]byte) {
-	cc.hmacKeys = keys
-}
-
-var errTypeNotSupported = errors.New("cookie: codec does not support value type")
-
-// encodeBytes percent encodes bytes not allowed in cookie values, bytes used
-// in percent encodings and delimiters used in this package.
-func encodeBytes(buf []byte, s string) []byte {
-	for i := 0; i < len(s); i++ {
-		b := s[i]
-		switch {
-		case b == ' ':
-			buf = append(buf, '+')
-		case // byte values not allowed in cookie value
-			b <= ' ' ||
-				b >= 127 ||
-				b == '"' ||
-				b == ',' ||
-				b == ';' ||
-				b == '\\' ||
-				// byte values with special meaning in percent encoding
-				b == '+' ||
-				b == '%' ||
-				// value deliminter
-				b == '|' ||
-				// string slice delimiter
-				b == '!':
-			buf = append(buf, '%', "0123456789ABCDEF"[b>>4], "0123456789ABCDEF"[b&15])
-		default:
-			buf = append(buf, b)
-		}
+	switch cc.sameSite {
+	case http.SameSiteLaxMode:
+		buf = append(buf, "; SameSite=Lax"...)
+	case http.SameSiteStrictMode:
+		buf = append(buf, "; SameSite=Strict"...)
+	case http.SameSiteNoneMode:
+		buf = append(buf, "; SameSite=None"...)
 	}
-	return buf
-}
 
-func split(s string) (string, string) {
-	if i := strings.IndexByte(s, '|'); i >= 0 {
-		return s[:i], s[i+1:]
-	}
-	return s, ""
-}
-
-func encodeValues(buf []byte, values []interface{}) ([]byte, error) {
-	for i, v := range values {
-		if i != 0 {
-			buf = append(buf, '|')
-		}
-		switch v := v.(type) {
-		case nil:
-			// do nothing
-		case string:
-			buf = encodeBytes(buf, v)
-		case int:
-			buf = strconv.AppendInt(buf, int64(v), 36)
-		case int64:
-			buf = strconv.AppendInt(buf, v, 36)
-		case []string:
-			for j, v := range v {
-				if j != 0 {
-					buf = append(buf, '!')
-				}
-				buf = encodeBytes(buf, v)
-			}
-		case []int:
-			for j, v := range v {
-				if j != 0 {
-					buf = append(buf, '!')
-				}
-				buf = strconv.AppendInt(buf, int64(v), 36)
-			}
-		case []int64:
-			for j, v := range v {
-				if j != 0 {
-					buf = append(buf, '!')
-				}
-				buf = strconv.AppendInt(buf, v, 36)
-			}
-		default:
-			return nil, fmt.Errorf("cookie: value type %s not supported", reflect.TypeOf(v))
-		}
+	if cc.partitioned {
+		buf = append(buf, "; Partitioned"...)
 	}
-	return buf, nil
+
+	return string(buf)
 }
 
-func decodeValues(s string, values []interface{}) error {
-	for len(s) > 0 && len(values) > 0 {
-		var p string
-		p, s = split(s)
-		switch v := values[0].(type) {
-		case nil:
-			// do nothing
-		case *string:
-			var err error
-			*v, err = url.QueryUnescape(p)
-			if err != nil {
-				return err
-			}
-		case *int:
-			n, err := strconv.ParseInt(p, 36, 0)
-			if err != nil {
-				return err
-			}
-			*v = int(n)
-		case *int64:
-			n, err := strconv.ParseInt(p, 36, 64)
-			if err != nil {
-				return err
-			}
-			*v = n
-		case *[]string:
-			for _, q := range strings.Split(p, "!") {
-				r, err := url.QueryUnescape(q)
-				if err != nil {
-					return err
-				}
-				*v = append(*v, r)
-			}
-		case *[]int:
-			for _, q := range strings.Split(p, "!") {
-				n, err := strconv.ParseInt(q, 36, 0)
-				if err != nil {
-					return err
-				}
-				*v = append(*v, int(n))
-			}
-		case *[]int64:
-			for _, q := range strings.Split(p, "!") {
-				n, err := strconv.ParseInt(q, 36, 64)
-				if err != nil {
-					return err
-				}
-				*v = append(*v, n)
-			}
-		default:
-			return fmt.Errorf("cookie: value type %s not supported", reflect.TypeOf(v))
-		}
-		values = values[1:]
-	}
-	return nil
+func (cc *Codec) SetHMACKeys(keys [][]byte) {
+	cc.hmacKeys = keys
 }
 
 // WithPath sets the cookie path attribute. The path must either be "" or start
@@ -370,11 +676,81 @@ func WithSecure(secure bool) Option { return Option{func(cc *Codec) { cc.secure
 // WithHTTPOnly sets the httponly attribute. The default value for the httponly attribute is true.
 func WithHTTPOnly(httpOnly bool) Option { return Option{func(cc *Codec) { cc.httpOnly = httpOnly }} }
 
+// WithSameSite sets the SameSite attribute. If sameSite is
+// http.SameSiteDefaultMode, then the attribute is not included in the header
+// value. SameSite=None requires the secure attribute.
+func WithSameSite(sameSite http.SameSite) Option {
+	return Option{func(cc *Codec) { cc.sameSite = sameSite }}
+}
+
+// WithPartitioned sets the Partitioned attribute used to store the cookie in
+// partitioned storage (CHIPS). Partitioned cookies require the secure
+// attribute.
+func WithPartitioned(partitioned bool) Option {
+	return Option{func(cc *Codec) { cc.partitioned = partitioned }}
+}
+
 // WithHashFunc sets the hash algorithm used to create HMAC. The default value for
-// the hash algorithm is crypto/sha1.New.
+// the hash algorithm is crypto/sha256.New. The option does not apply to
+// values in the legacy format. Use WithLegacyHashFunc for those values.
 func WithHashFunc(f func() hash.Hash) Option { return Option{func(cc *Codec) { cc.hashFunc = f }} }
 
+// WithLegacyHashFunc sets the hash algorithm used to check values in the
+// legacy format. The default is crypto/sha1.New, the default for that format.
+// Use this option if the application set a hash function before upgrading to
+// the current format.
+func WithLegacyHashFunc(f func() hash.Hash) Option {
+	return Option{func(cc *Codec) { cc.legacyHashFunc = f }}
+}
+
 // WithHMACKeys specifies the keys for signing cookies. Multiple keys are allowed
 // to support key rotation. Cookies are signed with the first key. If keys is
 // nil, then the cookie is not signed.
 func WithHMACKeys(keys [][]byte) Option { return Option{func(cc *Codec) { cc.hmacKeys = keys }} }
+
+// WithRefresh specifies the fraction of the maximum age after which
+// DecodeAndReissue refreshes a cookie. For example, if the maximum age is one
+// hour and the fraction is 0.5, then DecodeAndReissue reissues cookies older
+// than 30 minutes. The fraction must be between 0 and 1 and the maximum age
+// must be set with WithMaxAge.
+func WithRefresh(fraction float64) Option {
+	return Option{func(cc *Codec) { cc.refresh = fraction }}
+}
+
+// WithAbsoluteLifetime specifies the maximum lifetime of a value from the
+// time that the value was first encoded. Refreshes by DecodeAndReissue do not
+// extend the absolute lifetime.
+func WithAbsoluteLifetime(d time.Duration) Option {
+	return Option{func(cc *Codec) { cc.absoluteLifetime = d }}
+}
+
+// WithLegacyUntil specifies the end of the transition from the legacy signed
+// format. The legacy format signs values with a hex encoded HMAC and does not
+// include a format version. By default, Decode accepts values signed with the
+// HMAC keys in the legacy format so that existing cookies remain valid after
+// upgrading. Use DecodeAndReissue to replace legacy cookies during the
+// transition and set t to a time at least the maximum age of the cookie after
+// the upgrade. Use the zero time to reject all values in the legacy format.
+func WithLegacyUntil(t time.Time) Option {
+	return Option{func(cc *Codec) { cc.legacyUntil = &t }}
+}
+
+// WithEncryptionKeys specifies the keys for encrypting cookies. Multiple keys
+// are allowed to support key rotation. Cookies are encrypted with the first
+// key. The encrypted value includes the timestamp and is authenticated, so
+// HMAC keys are not needed to protect the value.
+//
+// If HMAC keys are also specified, then Decode accepts signed cookies that are
+// not encrypted. Use this to migrate from signed to encrypted cookies: keep the
+// HMAC keys until the signed cookies issued before the migration have expired.
+func WithEncryptionKeys(keys [][]byte) Option {
+	return Option{func(cc *Codec) { cc.encKeys = keys }}
+}
+
+// WithAEAD sets the function used to create the authenticated encryption
+// cipher for an encryption key. The default function creates AES-GCM using
+// the key size to select AES-128, AES-192 or AES-256. Use
+// golang.org/x/crypto/chacha20poly1305.New for ChaCha20-Poly1305.
+func WithAEAD(f func(key []byte) (cipher.AEAD, error)) Option {
+	return Option{func(cc *Codec) { cc.newAEAD = f }}
+}
@@ -5,9 +5,17 @@
 package cookie
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -43,6 +51,96 @@ var encodeDecodeValueTests = []struct {
 	{
 		values: []interface{}{[]int64{-9223372036854775808, -1, 0, 1, 9223372036854775807}},
 	},
+	{
+		values: []interface{}{true, false, uint(0), uint64(18446744073709551615), uint8(255)},
+	},
+	{
+		values: []interface{}{1.5, -2.25e-10, 1e300, float32(3.25)},
+	},
+	{
+		values: []interface{}{time.Unix(1136214245, 0).UTC(), time.Unix(1136214245, 999999999).UTC(), time.Time{}},
+	},
+	{
+		values: []interface{}{90 * time.Minute, -time.Nanosecond},
+	},
+	{
+		values: []interface{}{[]byte("hello|world!\x00"), []bool{true, false}, []float64{0.5, 1}},
+	},
+	{
+		values: []interface{}{map[string]int{"a": 1, "b=c": 2, "d!e": 3}},
+	},
+	{
+		values: []interface{}{map[string][]string{"x": {"1", "2"}, "y": {"a|b"}}},
+	},
+	{
+		values: []interface{}{net.ParseIP("10.0.0.1"), [2]string{"a", "b"}},
+	},
+	{
+		values: []interface{}{testStruct{
+			User:   "bob smith",
+			Roles:  []string{"admin", "user!"},
+			Admin:  true,
+			Expiry: time.Unix(1136214245, 0).UTC(),
+			Inner:  testInner{A: "x=y", B: []int{1, 2}},
+			Inners: []testInner{{A: "1"}, {A: "2", B: []int{3}}},
+			Attrs:  map[string]string{"k": "v%"},
+		}},
+	},
+}
+
+type testInner struct {
+	A string `cookie:"a"`
+	B []int  `cookie:"b,omitempty"`
+}
+
+type testStruct struct {
+	User    string            `cookie:"u"`
+	Roles   []string          `cookie:"r"`
+	Admin   bool              `cookie:"adm"`
+	Expiry  time.Time         `cookie:"exp"`
+	Inner   testInner         `cookie:"i"`
+	Inners  []testInner       `cookie:"is"`
+	Attrs   map[string]string `cookie:"m"`
+	Skip    string            `cookie:"-"`
+	private string
+}
+
+var encodeValueTests = []struct {
+	value interface{}
+	s     string
+}{
+	{[]string{"Hello!", "World!"}, "Hello%21!World%21"},
+	{1.0e6, "1e06"},
+	{testInner{A: "x", B: []int{10, 11}}, "1!a=x!b=a%21b"},
+	{[]testInner{{A: "x"}, {A: "y"}}, "1%21a%3Dx!1%21a%3Dy"},
+	{map[string]bool{"b": true, "a": false}, "1!a=0!b=1"},
+	{time.Duration(36), "10"},
+}
+
+func TestEncodeValue(t *testing.T) {
+	for _, tt := range encodeValueTests {
+		p, err := encodeValues(nil, []interface{}{tt.value})
+		if err != nil {
+			t.Errorf("encodeValues(nil, %#v) returned error %v", tt.value, err)
+			continue
+		}
+		if string(p) != tt.s {
+			t.Errorf("encodeValues(nil, %#v) = %q, want %q", tt.value, p, tt.s)
+		}
+	}
+}
+
+func TestDecodeStructIgnoresUnknownFields(t *testing.T) {
+	var v testInner
+	if err := decodeValues("1!z=1!a=x", []interface{}{&v}); err != nil {
+		t.Fatal(err)
+	}
+	if v.A != "x" {
+		t.Errorf("A = %q, want %q", v.A, "x")
+	}
+	if err := decodeValues("2!a=x", []interface{}{&v}); err == nil {
+		t.Errorf("decode of unknown format version did not return error")
+	}
 }
 
 func TestEncodeDecodeValue(t *testing.T) {
@@ -131,11 +229,11 @@ var cookieEncodeDecodeTests = []struct {
 	},
 	{
 		cc: NewCodec("hmac", WithPath(""), WithHTTPOnly(false), WithHMACKeys([][]byte{[]byte("key1"), []byte("key2")})),
-		h:  "hmac=b1d674f6bdcc43616c8460025d0f1c774b43e774|ish0it|foo",
+		h:  "hmac=2.dEgwhmTTIvm3k4-LFJ0ul_-mOSPmzj0rsmXdTSxgMow|ish0it|foo",
 	},
 	{
 		cc: NewCodec("hmacMaxAge", WithPath(""), WithHTTPOnly(false), WithHMACKeys([][]byte{[]byte("key1"), []byte("key2")}), WithMaxAge(time.Second)),
-		h:  "hmacMaxAge=49d5fc4c42969d0f8a6ad7a629034a7e8f7b1f63|ish0it|foo; max-age=1; expires=Mon, 02 Jan 2006 15:04:06 GMT",
+		h:  "hmacMaxAge=2.KkuJAQTQ_iKeWG4E6wTTdWWDKg_X6S-ShPynOqLMMTI|ish0it|foo; max-age=1; expires=Mon, 02 Jan 2006 15:04:06 GMT",
 	},
 }
 
@@ -174,3 +272,328 @@ func TestCookieEncodeDecode(t *testing.T) {
 		}
 	}
 }
+
+func TestLegacyFormat(t *testing.T) {
+	testTime, _ := time.Parse("Mon Jan 2 15:04:05 MST 2006", "Mon Jan 2 15:04:05 UTC 2006")
+	now = func() time.Time { return testTime }
+	defer func() { now = time.Now }()
+
+	keys := [][]byte{[]byte("key1"), []byte("key2")}
+	r := &http.Request{Header: http.Header{"Cookie": {"hmac=b1d674f6bdcc43616c8460025d0f1c774b43e774|ish0it|foo"}}}
+
+	// Legacy values are accepted with the default options.
+	var s string
+	cc := NewCodec("hmac", WithHMACKeys(keys))
+	if err := cc.Decode(r, &s); err != nil || s != "foo" {
+		t.Errorf("Decode(legacy) = %q, %v, want foo", s, err)
+	}
+
+	w := httptest.NewRecorder()
+	if err := cc.DecodeAndReissue(w, r, &s); err != nil || s != "foo" {
+		t.Errorf("DecodeAndReissue(legacy) = %q, %v, want foo", s, err)
+	}
+	h := w.Header().Get("Set-Cookie")
+	if !strings.HasPrefix(h, "hmac=2.") {
+		t.Errorf("DecodeAndReissue(legacy) set cookie %q, want current format", h)
+	}
+
+	// Current format values are not reissued.
+	w = httptest.NewRecorder()
+	r = &http.Request{Header: http.Header{"Cookie": {h[:strings.IndexByte(h, ';')]}}}
+	if err := cc.DecodeAndReissue(w, r, &s); err != nil || s != "foo" {
+		t.Errorf("DecodeAndReissue(current) = %q, %v, want foo", s, err)
+	}
+	if h := w.Header().Get("Set-Cookie"); h != "" {
+		t.Errorf("DecodeAndReissue(current) set cookie %q", h)
+	}
+
+	r = &http.Request{Header: http.Header{"Cookie": {"hmac=b1d674f6bdcc43616c8460025d0f1c774b43e774|ish0it|foo"}}}
+	cc = NewCodec("hmac", WithHMACKeys(keys), WithLegacyUntil(testTime.Add(time.Second)))
+	if err := cc.Decode(r, &s); err != nil {
+		t.Errorf("Decode(legacy) during transition returned %v", err)
+	}
+	cc = NewCodec("hmac", WithHMACKeys(keys), WithLegacyUntil(testTime))
+	if err := cc.Decode(r, &s); err == nil {
+		t.Error("Decode(legacy) after transition did not return error")
+	}
+	cc = NewCodec("hmac", WithHMACKeys(keys), WithLegacyUntil(time.Time{}))
+	if err := cc.Decode(r, &s); err == nil {
+		t.Error("Decode(legacy) with legacy format disabled did not return error")
+	}
+
+	// The hash function for the current format does not apply to legacy
+	// values.
+	cc = NewCodec("hmac", WithHMACKeys(keys), WithHashFunc(sha512.New))
+	if err := cc.Decode(r, &s); err != nil || s != "foo" {
+		t.Errorf("Decode(legacy) with WithHashFunc = %q, %v, want foo", s, err)
+	}
+
+	// Legacy values are checked with the legacy hash function.
+	r = &http.Request{Header: http.Header{"Cookie": {"hmac=" + legacySignature(sha256.New, keys[0], "hmac", "ish0it|foo") + "|ish0it|foo"}}}
+	cc = NewCodec("hmac", WithHMACKeys(keys), WithHashFunc(sha256.New))
+	if err := cc.Decode(r, &s); err == nil {
+		t.Error("Decode(legacy SHA-256) with default legacy hash did not return error")
+	}
+	cc = NewCodec("hmac", WithHMACKeys(keys), WithLegacyHashFunc(sha256.New))
+	if err := cc.Decode(r, &s); err != nil || s != "foo" {
+		t.Errorf("Decode(legacy SHA-256) = %q, %v, want foo", s, err)
+	}
+}
+
+// legacySignature returns the legacy format signature for value v.
+func legacySignature(f func() hash.Hash, key []byte, name, v string) string {
+	m := hmac.New(f, key)
+	io.WriteString(m, name+"|"+v)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+func TestRefresh(t *testing.T) {
+	t0 := time.Unix(1136214245, 0)
+	tn := t0
+	now = func() time.Time { return tn }
+	defer func() { now = time.Now }()
+
+	cc := NewCodec("c", WithHMACKeys([][]byte{[]byte("key")}), WithMaxAge(time.Hour),
+		WithRefresh(0.5), WithAbsoluteLifetime(3*time.Hour))
+
+	w := httptest.NewRecorder()
+	cc.Encode(w, "hello")
+	h := w.Header().Get("Set-Cookie")
+	c := h[:strings.IndexByte(h, ';')]
+
+	var s string
+	issued, err := cc.DecodeTime(&http.Request{Header: http.Header{"Cookie": {c}}}, &s)
+	if err != nil || !issued.Equal(t0) || s != "hello" {
+		t.Errorf("DecodeTime() = %v, %q, %v, want %v, hello", issued, s, err, t0)
+	}
+
+	tests := []struct {
+		elapsed time.Duration
+		maxAge  string // max-age of refreshed cookie or "" if not refreshed
+		err     bool
+	}{
+		{10 * time.Minute, "", false},
+		{40 * time.Minute, "3600", false},
+		{80 * time.Minute, "3600", false},
+		{100 * time.Minute, "", false},
+		{140 * time.Minute, "2400", false},
+		{170 * time.Minute, "600", false},
+		{181 * time.Minute, "", true},
+	}
+	for _, tt := range tests {
+		tn = t0.Add(tt.elapsed)
+		w := httptest.NewRecorder()
+		err := cc.DecodeAndReissue(w, &http.Request{Header: http.Header{"Cookie": {c}}}, &s)
+		if (err != nil) != tt.err {
+			t.Errorf("%v: DecodeAndReissue returned %v", tt.elapsed, err)
+			continue
+		}
+		h := w.Header().Get("Set-Cookie")
+		if tt.maxAge == "" {
+			if h != "" {
+				t.Errorf("%v: DecodeAndReissue set cookie %q, want none", tt.elapsed, h)
+			}
+			continue
+		}
+		if !strings.Contains(h, "max-age="+tt.maxAge+";") {
+			t.Errorf("%v: DecodeAndReissue set cookie %q, want max-age=%s", tt.elapsed, h, tt.maxAge)
+		}
+		c = h[:strings.IndexByte(h, ';')]
+		issued, err := cc.DecodeTime(&http.Request{Header: http.Header{"Cookie": {c}}}, &s)
+		if err != nil || !issued.Equal(tn) {
+			t.Errorf("%v: DecodeTime() = %v, %v, want %v", tt.elapsed, issued, err, tn)
+		}
+	}
+}
+
+func encodeDecode(encoder, decoder *Codec, value string) (string, error) {
+	w := httptest.NewRecorder()
+	if err := encoder.Encode(w, value); err != nil {
+		return "", err
+	}
+	h := w.Header().Get("Set-Cookie")
+	if i := strings.IndexByte(h, ';'); i >= 0 {
+		h = h[:i]
+	}
+	r := &http.Request{Header: http.Header{"Cookie": {h}}}
+	var s string
+	err := decoder.Decode(r, &s)
+	return s, err
+}
+
+func TestEncryption(t *testing.T) {
+	key1 := []byte("0123456789abcdef")
+	key2 := []byte("fedcba9876543210fedcba9876543210")
+	hmacKeys := [][]byte{[]byte("key1")}
+
+	encrypted := NewCodec("enc", WithEncryptionKeys([][]byte{key1}))
+	rotated := NewCodec("enc", WithEncryptionKeys([][]byte{key2, key1}))
+	migrating := NewCodec("enc", WithEncryptionKeys([][]byte{key1}), WithHMACKeys(hmacKeys))
+	signed := NewCodec("enc", WithHMACKeys(hmacKeys))
+	other := NewCodec("other", WithEncryptionKeys([][]byte{key1}))
+
+	tests := []struct {
+		name             string
+		encoder, decoder *Codec
+		ok               bool
+	}{
+		{"encrypted", encrypted, encrypted, true},
+		{"rotated old key", encrypted, rotated, true},
+		{"rotated new key", rotated, rotated, true},
+		{"removed key", rotated, encrypted, false},
+		{"migrate signed", signed, migrating, true},
+		{"migrate encrypted", migrating, migrating, true},
+		{"signed not accepted", signed, encrypted, false},
+		{"encrypted not signed", encrypted, signed, false},
+		{"name is authenticated", other, encrypted, false},
+	}
+	for _, tt := range tests {
+		s, err := encodeDecode(tt.encoder, tt.decoder, "hello|world")
+		if tt.ok && (err != nil || s != "hello|world") {
+			t.Errorf("%s: got %q, %v, want %q, nil", tt.name, s, err, "hello|world")
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%s: got %q, want error", tt.name, s)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	encrypted.Encode(w, "secret")
+	if h := w.Header().Get("Set-Cookie"); strings.Contains(h, "secret") {
+		t.Errorf("encrypted cookie %q contains plaintext", h)
+	}
+}
+
+// setCookieGrammar matches the set-cookie-string production in RFC 6265bis
+// for the attributes generated by the codec.
+var setCookieGrammar = regexp.MustCompile(`^` +
+	`[!#$%&'*+\-.^_` + "`" + `|~0-9A-Za-z]+=` + // cookie-name "="
+	`(?:[\x21\x23-\x2B\x2D-\x3A\x3C-\x5B\x5D-\x7E]*|"[\x21\x23-\x2B\x2D-\x3A\x3C-\x5B\x5D-\x7E]*")` + // cookie-value
+	`(?:; (?i:` +
+	`expires=(?:Mon|Tue|Wed|Thu|Fri|Sat|Sun), [0-9]{2} (?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) [0-9]{4} [0-9]{2}:[0-9]{2}:[0-9]{2} GMT` +
+	`|max-age=-?[0-9]+` +
+	`|domain=[^\x00-\x1F\x7F;]+` +
+	`|path=[^\x00-\x1F\x7F;]+` +
+	`|secure` +
+	`|httponly` +
+	`|samesite=(?:Strict|Lax|None)` +
+	`|partitioned` +
+	`))*$`)
+
+var attributeTests = []struct {
+	cc *Codec
+	h  string
+}{
+	{
+		cc: NewCodec("lax", WithSameSite(http.SameSiteLaxMode)),
+		h:  "lax=foo; path=/; HttpOnly; SameSite=Lax",
+	},
+	{
+		cc: NewCodec("strict", WithPath(""), WithHTTPOnly(false), WithSameSite(http.SameSiteStrictMode)),
+		h:  "strict=foo; SameSite=Strict",
+	},
+	{
+		cc: NewCodec("none", WithSecure(true), WithSameSite(http.SameSiteNoneMode), WithPartitioned(true)),
+		h:  "none=foo; path=/; secure; HttpOnly; SameSite=None; Partitioned",
+	},
+	{
+		cc: NewCodec("__Host-id", WithSecure(true), WithMaxAge(time.Hour)),
+		h:  "__Host-id=foo; path=/; max-age=3600; expires=Mon, 02 Jan 2006 16:04:05 GMT; secure; HttpOnly",
+	},
+	{
+		cc: NewCodec("__Secure-id", WithSecure(true), WithDomain("example.com"), WithPath("/app")),
+		h:  "__Secure-id=foo; path=/app; domain=example.com; secure; HttpOnly",
+	},
+	{
+		cc: NewCodec("enc", WithEncryptionKeys([][]byte{[]byte("0123456789abcdef")})),
+	},
+	{
+		cc: NewCodec("hmac", WithHMACKeys([][]byte{[]byte("key")}), WithMaxAge(time.Second)),
+	},
+}
+
+func TestAttributes(t *testing.T) {
+	testTime, _ := time.Parse("Mon Jan 2 15:04:05 MST 2006", "Mon Jan 2 15:04:05 UTC 2006")
+	now = func() time.Time { return testTime }
+	defer func() { now = time.Now }()
+
+	for _, tt := range attributeTests {
+		for _, values := range [][]interface{}{{"foo"}, nil} {
+			w := httptest.NewRecorder()
+			if err := tt.cc.Encode(w, values...); err != nil {
+				t.Errorf("%s: Encode returned error %v", tt.cc.name, err)
+				continue
+			}
+			h := w.Header().Get("Set-Cookie")
+			if !setCookieGrammar.MatchString(h) {
+				t.Errorf("%s: %q does not match the RFC 6265bis grammar", tt.cc.name, h)
+			}
+			if values != nil && tt.h != "" && h != tt.h {
+				t.Errorf("%s: got %q, want %q", tt.cc.name, h, tt.h)
+			}
+		}
+	}
+}
+
+var invalidCodecTests = []struct {
+	name    string
+	options []Option
+}{
+	{"bad name", nil},
+	{"none", []Option{WithSameSite(http.SameSiteNoneMode)}},
+	{"partitioned", []Option{WithPartitioned(true)}},
+	{"__Secure-id", nil},
+	{"__secure-id", nil},
+	{"__Host-id", nil},
+	{"__Host-id", []Option{WithSecure(true), WithDomain("example.com")}},
+	{"__Host-id", []Option{WithSecure(true), WithPath("/app")}},
+	{"__Host-id", []Option{WithSecure(true), WithPath("")}},
+	{"path", []Option{WithPath("app")}},
+	{"path", []Option{WithPath("/a;b")}},
+	{"domain", []Option{WithDomain("example.com\n")}},
+}
+
+func TestInvalidCodec(t *testing.T) {
+	for _, tt := range invalidCodecTests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewCodec(%q, ...) did not panic", tt.name)
+				}
+			}()
+			NewCodec(tt.name, tt.options...)
+		}()
+	}
+}
+
+func TestRename(t *testing.T) {
+	cc := NewCodec("a", WithHMACKeys([][]byte{[]byte("key")}))
+	b := cc.Rename("b")
+	c, err := b.NewCookie("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "b" {
+		t.Errorf("Name = %q, want b", c.Name)
+	}
+	var s string
+	if err := b.DecodeCookie(c, &s); err != nil || s != "hello" {
+		t.Errorf("DecodeCookie() = %q, %v, want hello", s, err)
+	}
+	// The name is bound to the signature.
+	c.Name = "a"
+	if err := cc.DecodeCookie(c, &s); err == nil {
+		t.Error("DecodeCookie() with original name did not return error")
+	}
+
+	for _, name := range []string{"a b", "__Host-a"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Rename(%q) did not panic", name)
+				}
+			}()
+			cc.Rename(name)
+		}()
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import "errors"
+
+// Reasons for decode errors. Use errors.Is to test the reason for an error
+// returned from the codec decode methods.
+var (
+	// ErrNotFound is the reason when the request does not have the cookie.
+	ErrNotFound = errors.New("cookie not found")
+
+	// ErrMalformed is the reason when the cookie value does not have the
+	// expected format.
+	ErrMalformed = errors.New("malformed value")
+
+	// ErrInvalid is the reason when the cookie value fails the signature or
+	// decryption check. The value was tampered with or was signed with a
+	// key that the codec does not have.
+	ErrInvalid = errors.New("invalid signature")
+
+	// ErrExpired is the reason when the cookie value has expired.
+	ErrExpired = errors.New("expired")
+)
+
+// ErrTooLarge is returned by Encode when the encoded value exceeds the browser
+// limit or the chunk budget.
+var ErrTooLarge = errors.New("cookie: value too large")
+
+// DecodeError is the error returned by the codec decode methods.
+type DecodeError struct {
+	Name   string // Cookie name.
+	Reason error  // ErrNotFound, ErrMalformed, ErrInvalid or ErrExpired.
+	Detail string // Description of the error.
+}
+
+func (e *DecodeError) Error() string {
+	return "cookie: " + e.Name + ": " + e.Detail
+}
+
+// Unwrap returns the reason for the error.
+func (e *DecodeError) Unwrap() error { return e.Reason }
+
+func (cc *Codec) decodeError(reason error, detail string) *DecodeError {
+	return &DecodeError{Name: cc.name, Reason: reason, Detail: detail}
+}
+
+// WithTamperHook sets a function that is called when a cookie value fails the
+// signature or decryption check or a signed or encrypted value is malformed.
+// Use the hook to count or log tampering attempts separately from expired
+// cookies. The hook is called for each cookie that fails the checks when
+// decoding fails. The hook is not called when a cookie is missing or expired.
+func WithTamperHook(f func(err *DecodeError)) Option {
+	return Option{func(cc *Codec) { cc.tamperHook = f }}
+}
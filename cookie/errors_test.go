@@ -0,0 +1,72 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeError(t *testing.T) {
+	t0 := time.Unix(1136214245, 0)
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+
+	var tampered []*DecodeError
+	cc := NewCodec("c", WithHMACKeys([][]byte{[]byte("key")}), WithMaxAge(time.Hour),
+		WithTamperHook(func(err *DecodeError) { tampered = append(tampered, err) }))
+	s := encodeSetCookie(t, cc, "hello")
+
+	var decodeErrorTests = []struct {
+		cookie string
+		reason error
+		tamper bool
+	}{
+		{"other=x", ErrNotFound, false},
+		{strings.Replace(s, "hello", "HELLO", 1), ErrInvalid, true},
+		{"c=garbage", ErrInvalid, true},
+		{"c=|x", ErrMalformed, true},
+		{"c=2.k1.abc|x", ErrMalformed, true},
+	}
+
+	for _, tt := range decodeErrorTests {
+		tampered = nil
+		var v string
+		err := cc.Decode(requestWithCookie(tt.cookie), &v)
+		var e *DecodeError
+		if !errors.As(err, &e) || e.Name != "c" {
+			t.Errorf("Decode(%q) returned %#v, want *DecodeError with name c", tt.cookie, err)
+			continue
+		}
+		if !errors.Is(err, tt.reason) {
+			t.Errorf("Decode(%q) reason = %v, want %v", tt.cookie, e.Reason, tt.reason)
+		}
+		if (len(tampered) > 0) != tt.tamper {
+			t.Errorf("Decode(%q) tamper hook called %d times, want %v", tt.cookie, len(tampered), tt.tamper)
+		}
+	}
+
+	// Expired values do not call the tamper hook.
+	t0 = t0.Add(2 * time.Hour)
+	tampered = nil
+	var v string
+	if err := cc.Decode(requestWithCookie(s), &v); !errors.Is(err, ErrExpired) || len(tampered) != 0 {
+		t.Errorf("Decode(expired) = %v, tamper hook called %d times", err, len(tampered))
+	}
+
+	// A valid cookie shadowed by another cookie with the same name does not
+	// call the tamper hook.
+	t0 = t0.Add(-2 * time.Hour)
+	if err := cc.Decode(requestWithCookie("c=garbage; "+s), &v); err != nil || len(tampered) != 0 {
+		t.Errorf("Decode(shadowed) = %v, tamper hook called %d times", err, len(tampered))
+	}
+
+	if err := cc.DecodeCookie(&http.Cookie{Name: "x", Value: s[2:]}, &v); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DecodeCookie(other name) = %v, want ErrNotFound", err)
+	}
+}
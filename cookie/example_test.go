@@ -11,19 +11,21 @@ import (
 	"github.com/garyburd/web/cookie"
 )
 
-func ExampleCodec(w http.ResponseWriter, r *http.Request) {
-	// Declare instance of codec at package level.
-	var exampleCodec = cookie.NewCodec("example", cookie.WithSecure(true))
+// Declare instance of codec at package level.
+var exampleCodec = cookie.NewCodec("example", cookie.WithSecure(true))
 
-	// Get the value of a cookie in a request handler.
-	var example string
-	if err := exampleCodec.Decode(r, &example); err != nil {
-		panic(err) // handle error
-	}
+func ExampleCodec() {
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// Get the value of a cookie in a request handler.
+		var example string
+		if err := exampleCodec.Decode(r, &example); err != nil {
+			panic(err) // handle error
+		}
 
-	// Set a cookie in a response handler.
-	if err := exampleCodec.Encode(w, example); err != nil {
-		panic(err) // handle error
-	}
-	io.WriteString(w, "hello world")
+		// Set a cookie in a response handler.
+		if err := exampleCodec.Encode(w, example); err != nil {
+			panic(err) // handle error
+		}
+		io.WriteString(w, "hello world")
+	})
 }
@@ -0,0 +1,69 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"net/http"
+	"time"
+)
+
+// NewCookie encodes values to a cookie. If values is empty, then the cookie
+// deletes the cookie in the browser. The cookie can be written to a response
+// with http.SetCookie, added to a client request with the request AddCookie
+// method or stored in a cookie jar. NewCookie returns ErrTooLarge if the
+// cookie exceeds the browser limit of 4096 bytes. NewCookie does not split
+// large values into chunks.
+func (cc *Codec) NewCookie(values ...interface{}) (*http.Cookie, error) {
+	buf, err := cc.encodeValue(time.Time{}, values)
+	if err != nil {
+		return nil, err
+	}
+	maxAge := cc.cookieMaxAge(time.Time{}, len(values) == 0)
+	if len(cc.name)+1+len(buf)+len(cc.attributes(maxAge)) > maxCookieSize {
+		return nil, ErrTooLarge
+	}
+	c := &http.Cookie{
+		Name:        cc.name,
+		Value:       string(buf),
+		Path:        cc.path,
+		Domain:      cc.domain,
+		Secure:      cc.secure,
+		HttpOnly:    cc.httpOnly,
+		SameSite:    cc.sameSite,
+		Partitioned: cc.partitioned,
+	}
+	switch {
+	case maxAge < 0:
+		c.MaxAge = -1
+		c.Expires = now().Add(maxAge)
+	case maxAge > 0:
+		c.MaxAge = int(maxAge / time.Second)
+		c.Expires = now().Add(maxAge)
+	}
+	return c, nil
+}
+
+// DecodeCookie decodes values from a cookie. The cookie name must match the
+// codec's name.
+func (cc *Codec) DecodeCookie(c *http.Cookie, values ...interface{}) error {
+	if c.Name != cc.name {
+		return cc.decodeError(ErrNotFound, "cookie name "+c.Name+" does not match codec")
+	}
+	return cc.DecodeString(c.Value, values...)
+}
+
+// DecodeString decodes values from a cookie value. The value is the part of a
+// Cookie or Set-Cookie header after the cookie name and '='.
+func (cc *Codec) DecodeString(s string, values ...interface{}) error {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	var candidates []string
+	if s != "" && s != "." {
+		candidates = append(candidates, s)
+	}
+	_, err := cc.decodeCandidates(candidates, values)
+	return err
+}
@@ -0,0 +1,98 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPCookie(t *testing.T) {
+	testTime := time.Unix(1136214245, 0)
+	now = func() time.Time { return testTime }
+	defer func() { now = time.Now }()
+
+	cc := NewCodec("c", WithHMACKeys([][]byte{[]byte("key")}), WithMaxAge(time.Hour),
+		WithSecure(true), WithSameSite(http.SameSiteLaxMode), WithDomain("example.com"))
+
+	c, err := cc.NewCookie("hello", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "c" || c.Path != "/" || c.Domain != "example.com" || !c.Secure || !c.HttpOnly ||
+		c.SameSite != http.SameSiteLaxMode || c.MaxAge != 3600 || !c.Expires.Equal(testTime.Add(time.Hour)) {
+		t.Errorf("NewCookie() = %+v", c)
+	}
+
+	// The value written by http.SetCookie matches the value written by Encode.
+	w := httptest.NewRecorder()
+	http.SetCookie(w, c)
+	w2 := httptest.NewRecorder()
+	cc.Encode(w2, "hello", 42)
+	v1 := strings.SplitN(w.Header().Get("Set-Cookie"), ";", 2)[0]
+	v2 := strings.SplitN(w2.Header().Get("Set-Cookie"), ";", 2)[0]
+	if v1 != v2 {
+		t.Errorf("http.SetCookie value %q, Encode value %q", v1, v2)
+	}
+
+	var s string
+	var n int
+
+	// Client request.
+	r, _ := http.NewRequest("GET", "https://example.com/", nil)
+	r.AddCookie(&http.Cookie{Name: "other", Value: "x"})
+	r.AddCookie(c)
+	if err := cc.Decode(r, &s, &n); err != nil || s != "hello" || n != 42 {
+		t.Errorf("Decode(AddCookie) = %q, %d, %v", s, n, err)
+	}
+
+	// Cookie jar.
+	jar, _ := cookiejar.New(nil)
+	u, _ := url.Parse("https://www.example.com/")
+	jar.SetCookies(u, []*http.Cookie{c})
+	cookies := jar.Cookies(u)
+	if len(cookies) != 1 {
+		t.Fatalf("jar.Cookies() = %v", cookies)
+	}
+	s, n = "", 0
+	if err := cc.DecodeCookie(cookies[0], &s, &n); err != nil || s != "hello" || n != 42 {
+		t.Errorf("DecodeCookie(jar cookie) = %q, %d, %v", s, n, err)
+	}
+
+	if err := cc.DecodeString(c.Value, &s, &n); err != nil {
+		t.Errorf("DecodeString() returned %v", err)
+	}
+	if err := cc.DecodeString(`"`+c.Value+`"`, &s, &n); err != nil {
+		t.Errorf("DecodeString(quoted) returned %v", err)
+	}
+	if err := cc.DecodeString(strings.Replace(c.Value, "hello", "HELLO", 1), &s, &n); err == nil {
+		t.Error("DecodeString(tampered) did not return error")
+	}
+	if err := cc.DecodeCookie(&http.Cookie{Name: "x", Value: c.Value}, &s, &n); err == nil {
+		t.Error("DecodeCookie with other name did not return error")
+	}
+
+	// Delete.
+	c, err = cc.NewCookie()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxAge != -1 || !c.Expires.Before(testTime) {
+		t.Errorf("NewCookie() delete = %+v", c)
+	}
+	jar.SetCookies(u, []*http.Cookie{c})
+	if cookies := jar.Cookies(u); len(cookies) != 0 {
+		t.Errorf("jar.Cookies() after delete = %v", cookies)
+	}
+
+	if _, err := cc.NewCookie(strings.Repeat("x", maxCookieSize)); err != ErrTooLarge {
+		t.Errorf("NewCookie(large) returned %v, want ErrTooLarge", err)
+	}
+}
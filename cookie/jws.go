@@ -0,0 +1,289 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"hash"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// jwsHashes maps the supported JWS algorithms to hash functions.
+var jwsHashes = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+// WithJWS encodes signed values as JWS compact serialization tokens (RFC
+// 7515) so that services written in other languages can verify and read the
+// values with a JWT library. The algorithm alg is "HS256", "HS384" or
+// "HS512". The algorithm determines the hash function. WithHashFunc does not
+// apply to JWS tokens.
+//
+// The token has the claims:
+//
+//	iat  issue time
+//	exp  expiration time, if the codec has a maximum age
+//	aud  cookie name
+//	crt  creation time, if different from the issue time
+//
+// The values are encoded with encoding/json. A single struct or map value is
+// encoded as additional claims. Other values are encoded as a JSON array in
+// the claim "v". When the codec has a key ring, the key ID is included in the
+// token header as "kid".
+//
+// Decode rejects tokens with an algorithm other than alg, including "none".
+// The JWS format does not support encryption or compression.
+func WithJWS(alg string) Option {
+	return Option{func(cc *Codec) {
+		cc.jwsAlg = alg
+		cc.jwsHash = jwsHashes[alg]
+	}}
+}
+
+// checkJWS checks the options for the JWS format.
+func (cc *Codec) checkJWS() error {
+	switch {
+	case cc.jwsAlg == "":
+		return nil
+	case cc.jwsHash == nil:
+		return errors.New("cookie: unsupported JWS algorithm " + cc.jwsAlg)
+	case cc.encKeys != nil || cc.maxDecompressedSize > 0:
+		return errors.New("cookie: JWS format does not support encryption or compression")
+	case cc.hmacKeys == nil && cc.keyRing == nil:
+		return errors.New("cookie: JWS format requires signing keys")
+	}
+	return nil
+}
+
+type jwsHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// reservedClaims are set by the codec.
+var reservedClaims = []string{"iat", "exp", "aud", "crt"}
+
+// singleObject returns true if values is a single non-nil struct or map
+// value.
+func singleObject(values []interface{}) bool {
+	if len(values) != 1 || values[0] == nil {
+		return false
+	}
+	v := reflect.ValueOf(values[0])
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		return true
+	case reflect.Map:
+		return !v.IsNil()
+	}
+	return false
+}
+
+func jsonNumber(t time.Time) json.RawMessage {
+	p, _ := json.Marshal(t.Unix())
+	return p
+}
+
+// encodeJWS returns a JWS token for values.
+func (cc *Codec) encodeJWS(issued, created time.Time, values []interface{}) ([]byte, error) {
+	claims := make(map[string]json.RawMessage)
+	if singleObject(values) {
+		p, err := json.Marshal(values[0])
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(p, &claims); err != nil {
+			return nil, err
+		}
+		if claims == nil {
+			// The value encoded to null.
+			claims = make(map[string]json.RawMessage)
+		}
+		for _, name := range reservedClaims {
+			if _, ok := claims[name]; ok {
+				return nil, errors.New("cookie: value uses reserved claim " + name)
+			}
+		}
+	} else {
+		p, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		claims["v"] = p
+	}
+	claims["iat"] = jsonNumber(issued)
+	if cc.maxAge > 0 {
+		claims["exp"] = jsonNumber(issued.Add(cc.maxAge))
+	}
+	claims["aud"], _ = json.Marshal(cc.name)
+	if created.Unix() != issued.Unix() {
+		claims["crt"] = jsonNumber(created)
+	}
+
+	header := jwsHeader{Alg: cc.jwsAlg, Typ: "JWT"}
+	var key []byte
+	if cc.keyRing != nil {
+		k := cc.keyRing.signingKey(now())
+		if k == nil {
+			return nil, errors.New("cookie: no valid signing key")
+		}
+		header.Kid = k.ID
+		key = k.Secret
+	} else {
+		key = cc.hmacKeys[0]
+	}
+
+	ph, err := json.Marshal(&header)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	var buf []byte
+	buf = append(buf, base64Encoding.EncodeToString(ph)...)
+	buf = append(buf, '.')
+	buf = append(buf, base64Encoding.EncodeToString(pc)...)
+	h := hmac.New(cc.jwsHash, key)
+	h.Write(buf)
+	buf = append(buf, '.')
+	buf = append(buf, base64Encoding.EncodeToString(h.Sum(nil))...)
+	return buf, nil
+}
+
+// verifyJWS checks the signature and expiration time of a JWS token.
+func (cc *Codec) verifyJWS(s string) (*decoded, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, cc.decodeError(ErrMalformed, "bad JWS format")
+	}
+	ph, err := base64Encoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, cc.decodeError(ErrMalformed, "bad JWS format")
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(ph, &header); err != nil {
+		return nil, cc.decodeError(ErrMalformed, "bad JWS header")
+	}
+	// Accept the configured algorithm only. This rejects "none" and
+	// algorithm confusion attacks.
+	if header.Alg != cc.jwsAlg {
+		return nil, cc.decodeError(ErrInvalid, "unexpected JWS algorithm "+header.Alg)
+	}
+	sig, err := base64Encoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, cc.decodeError(ErrMalformed, "bad JWS format")
+	}
+	signed := []byte(s[:len(parts[0])+1+len(parts[1])])
+	check := func(key []byte) bool {
+		h := hmac.New(cc.jwsHash, key)
+		h.Write(signed)
+		return hmac.Equal(h.Sum(nil), sig)
+	}
+	switch {
+	case header.Kid != "":
+		if cc.keyRing == nil {
+			return nil, cc.decodeError(ErrInvalid, "unknown or expired key")
+		}
+		k := cc.keyRing.verificationKey(header.Kid, now())
+		if k == nil {
+			return nil, cc.decodeError(ErrInvalid, "unknown or expired key")
+		}
+		if !check(k.Secret) {
+			return nil, cc.decodeError(ErrInvalid, "bad HMAC")
+		}
+	default:
+		ok := false
+		for _, key := range cc.hmacKeys {
+			if check(key) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return nil, cc.decodeError(ErrInvalid, "bad HMAC")
+		}
+	}
+
+	pc, err := base64Encoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, cc.decodeError(ErrMalformed, "bad JWS format")
+	}
+	var claims map[string]json.RawMessage
+	if err := json.Unmarshal(pc, &claims); err != nil {
+		return nil, cc.decodeError(ErrMalformed, "bad JWS claims")
+	}
+	var aud string
+	var iat, exp, crt int64
+	if json.Unmarshal(claims["aud"], &aud) != nil || aud != cc.name ||
+		json.Unmarshal(claims["iat"], &iat) != nil {
+		return nil, cc.decodeError(ErrInvalid, "bad JWS claims")
+	}
+	crt = iat
+	if p, ok := claims["crt"]; ok && json.Unmarshal(p, &crt) != nil {
+		return nil, cc.decodeError(ErrMalformed, "bad JWS claims")
+	}
+	if p, ok := claims["exp"]; ok {
+		if json.Unmarshal(p, &exp) != nil {
+			return nil, cc.decodeError(ErrMalformed, "bad JWS claims")
+		}
+		if now().Unix() > exp {
+			return nil, cc.decodeError(ErrExpired, "expired")
+		}
+	}
+	d := &decoded{claims: claims, issued: time.Unix(iat, 0), created: time.Unix(crt, 0)}
+	if err := cc.checkExpiry(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// decodeClaims decodes values from JWS claims.
+func decodeClaims(claims map[string]json.RawMessage, values []interface{}) error {
+	if singleObject(values) {
+		for _, name := range reservedClaims {
+			delete(claims, name)
+		}
+		p, err := json.Marshal(claims)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(p, values[0])
+	}
+	var elements []json.RawMessage
+	if p, ok := claims["v"]; ok {
+		if err := json.Unmarshal(p, &elements); err != nil {
+			return err
+		}
+	}
+	for i, v := range values {
+		if i >= len(elements) {
+			break
+		}
+		if v == nil {
+			continue
+		}
+		if err := json.Unmarshal(elements[i], v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type jwsUser struct {
+	ID    int64    `json:"sub"`
+	Roles []string `json:"roles"`
+}
+
+func TestJWS(t *testing.T) {
+	t0 := time.Unix(1136214245, 0)
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+
+	key := []byte("0123456789abcdef")
+	cc := NewCodec("c", WithHMACKeys([][]byte{key}), WithMaxAge(time.Hour), WithJWS("HS256"))
+
+	c, err := cc.NewCookie(jwsUser{ID: 42, Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the token as another implementation would.
+	parts := strings.Split(c.Value, ".")
+	if len(parts) != 3 {
+		t.Fatalf("value %q is not a JWS compact token", c.Value)
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if base64.RawURLEncoding.EncodeToString(h.Sum(nil)) != parts[2] {
+		t.Errorf("signature does not verify")
+	}
+	var header map[string]interface{}
+	p, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	json.Unmarshal(p, &header)
+	if header["alg"] != "HS256" || header["typ"] != "JWT" {
+		t.Errorf("header = %v", header)
+	}
+	var claims map[string]interface{}
+	p, _ = base64.RawURLEncoding.DecodeString(parts[1])
+	json.Unmarshal(p, &claims)
+	want := map[string]interface{}{
+		"sub":   42.0,
+		"roles": []interface{}{"admin"},
+		"iat":   float64(t0.Unix()),
+		"exp":   float64(t0.Add(time.Hour).Unix()),
+		"aud":   "c",
+	}
+	if !reflect.DeepEqual(claims, want) {
+		t.Errorf("claims = %v, want %v", claims, want)
+	}
+
+	var u jwsUser
+	if err := cc.DecodeCookie(c, &u); err != nil || u.ID != 42 || len(u.Roles) != 1 {
+		t.Errorf("DecodeCookie() = %+v, %v", u, err)
+	}
+
+	// Multiple values are encoded in the "v" claim.
+	c, err = cc.NewCookie("hello", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	var n int
+	if err := cc.DecodeCookie(c, &s, &n); err != nil || s != "hello" || n != 7 {
+		t.Errorf("DecodeCookie() = %q, %d, %v", s, n, err)
+	}
+
+	// Another cookie name is rejected.
+	other := NewCodec("d", WithHMACKeys([][]byte{key}), WithJWS("HS256"))
+	if err := other.DecodeString(c.Value, &s, &n); !errors.Is(err, ErrInvalid) {
+		t.Errorf("DecodeString(other name) returned %v, want ErrInvalid", err)
+	}
+
+	t0 = t0.Add(2 * time.Hour)
+	if err := cc.DecodeCookie(c, &s, &n); !errors.Is(err, ErrExpired) {
+		t.Errorf("DecodeCookie(expired) returned %v, want ErrExpired", err)
+	}
+}
+
+func TestJWSHashFunc(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	for _, options := range [][]Option{
+		{WithHMACKeys([][]byte{key}), WithJWS("HS256"), WithHashFunc(sha1.New)},
+		{WithHMACKeys([][]byte{key}), WithHashFunc(sha1.New), WithJWS("HS256")},
+	} {
+		cc := NewCodec("c", options...)
+		c, err := cc.NewCookie("hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := c.Value
+		// The signature uses the hash for the algorithm in the header.
+		parts := strings.Split(v, ".")
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(parts[0] + "." + parts[1]))
+		if base64.RawURLEncoding.EncodeToString(h.Sum(nil)) != parts[2] {
+			t.Errorf("signature for %q does not verify with HS256", v)
+		}
+		var s string
+		if err := cc.DecodeString(v, &s); err != nil || s != "hello" {
+			t.Errorf("DecodeString() = %q, %v, want hello", s, err)
+		}
+	}
+}
+
+func TestJWSAlgorithm(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	cc := NewCodec("c", WithHMACKeys([][]byte{key}), WithJWS("HS256"))
+	cc512 := NewCodec("c", WithHMACKeys([][]byte{key}), WithJWS("HS512"))
+
+	enc := base64.RawURLEncoding.EncodeToString
+	payload := enc([]byte(`{"aud":"c","iat":1136214245,"v":["admin"]}`))
+	var s string
+
+	// alg none
+	for _, token := range []string{
+		enc([]byte(`{"alg":"none"}`)) + "." + payload + ".",
+		enc([]byte(`{"alg":"None"}`)) + "." + payload + ".",
+	} {
+		if err := cc.DecodeString(token, &s); !errors.Is(err, ErrInvalid) {
+			t.Errorf("DecodeString(%q) returned %v, want ErrInvalid", token, err)
+		}
+	}
+
+	// Algorithm confusion.
+	c, _ := cc512.NewCookie("admin")
+	if err := cc.DecodeString(c.Value, &s); !errors.Is(err, ErrInvalid) {
+		t.Errorf("HS256 codec decoded HS512 token: %v", err)
+	}
+	if err := cc512.DecodeString(c.Value, &s); err != nil || s != "admin" {
+		t.Errorf("HS512 DecodeString() = %q, %v", s, err)
+	}
+
+	// Native format values are not accepted.
+	native := NewCodec("c", WithHMACKeys([][]byte{key}))
+	c, _ = native.NewCookie("admin")
+	if err := cc.DecodeString(c.Value, &s); err == nil {
+		t.Error("JWS codec decoded native format value")
+	}
+}
+
+func TestJWSNilObject(t *testing.T) {
+	cc := NewCodec("c", WithHMACKeys([][]byte{[]byte("key")}), WithJWS("HS256"))
+	var m map[string]string
+	var u *jwsUser
+	for _, value := range []interface{}{m, u} {
+		c, err := cc.NewCookie(value)
+		if err != nil {
+			t.Errorf("NewCookie(%#v) returned %v", value, err)
+			continue
+		}
+		var v interface{} = "x"
+		if err := cc.DecodeCookie(c, &v); err != nil || v != nil {
+			t.Errorf("DecodeCookie() = %v, %v, want nil", v, err)
+		}
+	}
+}
+
+// nullObject is a struct that encodes to null.
+type nullObject struct{}
+
+func (nullObject) MarshalJSON() ([]byte, error) { return []byte("null"), nil }
+
+func TestJWSNullObject(t *testing.T) {
+	cc := NewCodec("c", WithHMACKeys([][]byte{[]byte("key")}), WithJWS("HS256"))
+	c, err := cc.NewCookie(nullObject{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v nullObject
+	if err := cc.DecodeCookie(c, &v); err != nil {
+		t.Errorf("DecodeCookie() returned %v", err)
+	}
+}
+
+func TestJWSKeyRing(t *testing.T) {
+	kr := mustKeyRing(t, Key{ID: "k1", Secret: []byte("0123456789abcdef")})
+	cc := NewCodec("c", WithKeyRing(kr), WithJWS("HS512"))
+	c, err := cc.NewCookie("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := base64.RawURLEncoding.DecodeString(strings.Split(c.Value, ".")[0])
+	if !strings.Contains(string(p), `"kid":"k1"`) {
+		t.Errorf("header %s does not have kid", p)
+	}
+	var s string
+	if err := cc.DecodeCookie(c, &s); err != nil || s != "hello" {
+		t.Errorf("DecodeCookie() = %q, %v", s, err)
+	}
+}
+
+var invalidJWSOptions = [][]Option{
+	{WithHMACKeys([][]byte{[]byte("key")}), WithJWS("RS256")},
+	{WithHMACKeys([][]byte{[]byte("key")}), WithJWS("none")},
+	{WithJWS("HS256")},
+	{WithEncryptionKeys([][]byte{[]byte("0123456789abcdef")}), WithJWS("HS256")},
+}
+
+func TestInvalidJWSOptions(t *testing.T) {
+	for i, options := range invalidJWSOptions {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%d: NewCodec did not panic", i)
+				}
+			}()
+			NewCodec("c", options...)
+		}()
+	}
+}
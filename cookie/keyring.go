@@ -0,0 +1,258 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// Key is a signing key with an ID and an optional validity period.
+type Key struct {
+	// ID identifies the key in signed cookie values. The ID is a non-empty
+	// string of ASCII letters, digits, '-' and '_'.
+	ID string
+
+	// Secret is the HMAC key.
+	Secret []byte
+
+	// NotBefore is the time that the codec starts signing with the key. If
+	// zero, then the key is valid from the start of time. The codec verifies
+	// values signed with the key before NotBefore so that keys can be
+	// distributed to all servers before use.
+	NotBefore time.Time
+
+	// NotAfter is the time that the key expires. The codec does not sign or
+	// verify values with an expired key. If zero, then the key does not
+	// expire.
+	NotAfter time.Time
+}
+
+func (k *Key) canSign(t time.Time) bool {
+	return (k.NotBefore.IsZero() || !t.Before(k.NotBefore)) && k.canVerify(t)
+}
+
+func (k *Key) canVerify(t time.Time) bool {
+	return k.NotAfter.IsZero() || t.Before(k.NotAfter)
+}
+
+// KeyRing is a set of signing keys. The ID of the signing key is included in
+// the cookie value so that the codec selects the verification key directly.
+type KeyRing struct {
+	keys []Key
+	ids  map[string]*Key
+}
+
+func isValidKeyID(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if !('a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b == '-' || b == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// minSecretSize is the minimum size of a key secret in bytes.
+const minSecretSize = 16
+
+// NewKeyRing returns a key ring for the given keys. The codec signs values
+// with the first key in the list that is valid at the time of signing.
+func NewKeyRing(keys ...Key) (*KeyRing, error) {
+	kr := &KeyRing{keys: keys, ids: make(map[string]*Key)}
+	for i := range kr.keys {
+		k := &kr.keys[i]
+		if !isValidKeyID(k.ID) {
+			return nil, fmt.Errorf("cookie: invalid key ID %q", k.ID)
+		}
+		if kr.ids[k.ID] != nil {
+			return nil, fmt.Errorf("cookie: duplicate key ID %q", k.ID)
+		}
+		if len(k.Secret) < minSecretSize {
+			return nil, fmt.Errorf("cookie: secret for key %q is shorter than %d bytes", k.ID, minSecretSize)
+		}
+		if !k.NotBefore.IsZero() && !k.NotAfter.IsZero() && !k.NotBefore.Before(k.NotAfter) {
+			return nil, fmt.Errorf("cookie: key %q expires before it is valid", k.ID)
+		}
+		kr.ids[k.ID] = k
+	}
+	return kr, nil
+}
+
+// Keys returns the keys in the key ring.
+func (kr *KeyRing) Keys() []Key {
+	return append([]Key(nil), kr.keys...)
+}
+
+// signingKey returns the key used to sign values at time t.
+func (kr *KeyRing) signingKey(t time.Time) *Key {
+	for i := range kr.keys {
+		if kr.keys[i].canSign(t) {
+			return &kr.keys[i]
+		}
+	}
+	return nil
+}
+
+// verificationKey returns the key with the given ID if the key can verify
+// values at time t.
+func (kr *KeyRing) verificationKey(id string, t time.Time) *Key {
+	k := kr.ids[id]
+	if k == nil || !k.canVerify(t) {
+		return nil
+	}
+	return k
+}
+
+// WithKeyRing specifies the keys for signing cookies. The ID of the signing
+// key is included in the cookie value. If HMAC keys are also specified with
+// WithHMACKeys, then Decode accepts values signed without a key ID using the
+// HMAC keys. Use this to migrate to key rings.
+func WithKeyRing(kr *KeyRing) Option {
+	return Option{func(cc *Codec) { cc.keyRing = kr }}
+}
+
+// GenerateKey returns a key with the given ID and a random secret of size
+// bytes.
+func GenerateKey(id string, size int) (Key, error) {
+	k := Key{ID: id, Secret: make([]byte, size)}
+	_, err := io.ReadFull(rand.Reader, k.Secret)
+	return k, err
+}
+
+// pemType is the PEM block type for keys.
+const pemType = "COOKIE KEY"
+
+// WriteKeyPEM writes the key as a PEM block. The ID and validity period are
+// written as PEM headers:
+//
+//	-----BEGIN COOKIE KEY-----
+//	Key-Id: 2014a
+//	Not-Before: 2014-01-01T00:00:00Z
+//	Not-After: 2015-01-01T00:00:00Z
+//
+//	base64 encoded secret
+//	-----END COOKIE KEY-----
+func WriteKeyPEM(w io.Writer, k Key) error {
+	headers := map[string]string{"Key-Id": k.ID}
+	if !k.NotBefore.IsZero() {
+		headers["Not-Before"] = k.NotBefore.UTC().Format(time.RFC3339)
+	}
+	if !k.NotAfter.IsZero() {
+		headers["Not-After"] = k.NotAfter.UTC().Format(time.RFC3339)
+	}
+	return pem.Encode(w, &pem.Block{Type: pemType, Headers: headers, Bytes: k.Secret})
+}
+
+// jsonKey is the JSON representation of a key. The secret is base64 encoded.
+type jsonKey struct {
+	ID        string `json:"id"`
+	Secret    []byte `json:"secret"`
+	NotBefore string `json:"notBefore,omitempty"`
+	NotAfter  string `json:"notAfter,omitempty"`
+}
+
+// jsonKeyFile is the JSON representation of a key file.
+type jsonKeyFile struct {
+	Keys []jsonKey `json:"keys"`
+}
+
+// MarshalKeysJSON returns the JSON representation of the keys:
+//
+//	{"keys": [{"id": "2014a", "secret": "base64 encoded secret",
+//	    "notBefore": "2014-01-01T00:00:00Z", "notAfter": "2015-01-01T00:00:00Z"}]}
+func MarshalKeysJSON(keys ...Key) ([]byte, error) {
+	var f jsonKeyFile
+	for _, k := range keys {
+		jk := jsonKey{ID: k.ID, Secret: k.Secret}
+		if !k.NotBefore.IsZero() {
+			jk.NotBefore = k.NotBefore.UTC().Format(time.RFC3339)
+		}
+		if !k.NotAfter.IsZero() {
+			jk.NotAfter = k.NotAfter.UTC().Format(time.RFC3339)
+		}
+		f.Keys = append(f.Keys, jk)
+	}
+	return json.MarshalIndent(&f, "", "  ")
+}
+
+func parseKeyTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// ParseKeyRing parses a key ring in the JSON format written by
+// MarshalKeysJSON or the PEM format written by WriteKeyPEM. The keys are used
+// in the order that they appear in data.
+func ParseKeyRing(data []byte) (*KeyRing, error) {
+	var keys []Key
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var f jsonKeyFile
+		if err := json.Unmarshal(trimmed, &f); err != nil {
+			return nil, err
+		}
+		for _, jk := range f.Keys {
+			k := Key{ID: jk.ID, Secret: jk.Secret}
+			var err error
+			if k.NotBefore, err = parseKeyTime(jk.NotBefore); err != nil {
+				return nil, err
+			}
+			if k.NotAfter, err = parseKeyTime(jk.NotAfter); err != nil {
+				return nil, err
+			}
+			keys = append(keys, k)
+		}
+	} else {
+		for {
+			var b *pem.Block
+			b, data = pem.Decode(data)
+			if b == nil {
+				break
+			}
+			if b.Type != pemType {
+				continue
+			}
+			k := Key{ID: b.Headers["Key-Id"], Secret: b.Bytes}
+			var err error
+			if k.NotBefore, err = parseKeyTime(b.Headers["Not-Before"]); err != nil {
+				return nil, err
+			}
+			if k.NotAfter, err = parseKeyTime(b.Headers["Not-After"]); err != nil {
+				return nil, err
+			}
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("cookie: no keys found")
+	}
+	return NewKeyRing(keys...)
+}
+
+// LoadKeyRing loads a key ring from a file. See ParseKeyRing for a
+// description of the file format.
+func LoadKeyRing(filename string) (*KeyRing, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	kr, err := ParseKeyRing(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return kr, nil
+}
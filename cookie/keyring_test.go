@@ -0,0 +1,148 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustKeyRing(t *testing.T, keys ...Key) *KeyRing {
+	kr, err := NewKeyRing(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func encodeSetCookie(t *testing.T, cc *Codec, value string) string {
+	w := httptest.NewRecorder()
+	if err := cc.Encode(w, value); err != nil {
+		t.Fatal(err)
+	}
+	h := w.Header().Get("Set-Cookie")
+	return h[:strings.IndexByte(h, ';')]
+}
+
+func requestWithCookie(c string) *http.Request {
+	return &http.Request{Header: http.Header{"Cookie": {c}}}
+}
+
+func TestKeyRing(t *testing.T) {
+	t0 := time.Unix(1136214245, 0).UTC()
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+
+	secret1 := []byte("0123456789abcdef")
+	secret2 := []byte("fedcba9876543210")
+	k1 := Key{ID: "k1", Secret: secret1, NotAfter: t0.Add(2 * time.Hour)}
+	k2 := Key{ID: "k2", Secret: secret2, NotBefore: t0.Add(time.Hour)}
+
+	// k2 is listed first, but is not valid for signing until t0+1h.
+	codec := NewCodec("c", WithKeyRing(mustKeyRing(t, k2, k1)))
+
+	w := httptest.NewRecorder()
+	codec.Encode(w, "hello")
+	if h := w.Header().Get("Set-Cookie"); !strings.HasPrefix(h, "c=2.k1.") {
+		t.Errorf("Set-Cookie = %q, want value signed with k1", h)
+	}
+	if s, err := encodeDecode(codec, codec, "hello"); err != nil || s != "hello" {
+		t.Errorf("encodeDecode() = %q, %v", s, err)
+	}
+
+	// A codec without k2 in the key ring cannot verify values signed with k2.
+	t0 = t0.Add(90 * time.Minute)
+	old := NewCodec("c", WithKeyRing(mustKeyRing(t, k1)))
+	if _, err := encodeDecode(codec, old, "hello"); err == nil {
+		t.Error("decode of value signed with unknown key did not return error")
+	}
+	if s, err := encodeDecode(old, codec, "hello"); err != nil || s != "hello" {
+		t.Errorf("decode of value signed with k1 = %q, %v", s, err)
+	}
+
+	// Values signed with k1 are not valid after k1 expires.
+	s := encodeSetCookie(t, old, "hello")
+	t0 = t0.Add(time.Hour)
+	var v string
+	if err := codec.Decode(requestWithCookie(s), &v); err == nil {
+		t.Error("decode of value signed with expired key did not return error")
+	}
+	if _, err := encodeDecode(old, old, "hello"); err == nil {
+		t.Error("Encode with expired key did not return error")
+	}
+
+	// Migrate from HMAC keys.
+	legacy := NewCodec("c", WithHMACKeys([][]byte{[]byte("key")}))
+	migrating := NewCodec("c", WithKeyRing(mustKeyRing(t, k2)), WithHMACKeys([][]byte{[]byte("key")}))
+	if s, err := encodeDecode(legacy, migrating, "hello"); err != nil || s != "hello" {
+		t.Errorf("decode of legacy value = %q, %v", s, err)
+	}
+	if _, err := encodeDecode(legacy, codec, "hello"); err == nil {
+		t.Error("decode of legacy value without HMAC keys did not return error")
+	}
+}
+
+var invalidKeyRingTests = [][]Key{
+	{{ID: "", Secret: []byte("0123456789abcdef")}},
+	{{ID: "a.b", Secret: []byte("0123456789abcdef")}},
+	{{ID: "a", Secret: []byte("short")}},
+	{{ID: "a", Secret: []byte("0123456789abcdef")}, {ID: "a", Secret: []byte("0123456789abcdef")}},
+	{{ID: "a", Secret: []byte("0123456789abcdef"), NotBefore: time.Unix(2, 0), NotAfter: time.Unix(1, 0)}},
+}
+
+func TestInvalidKeyRing(t *testing.T) {
+	for _, keys := range invalidKeyRingTests {
+		if _, err := NewKeyRing(keys...); err == nil {
+			t.Errorf("NewKeyRing(%v) did not return error", keys)
+		}
+	}
+}
+
+func TestParseKeyRing(t *testing.T) {
+	k1, err := GenerateKey("k1", 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k1.NotBefore = time.Unix(1136214245, 0).UTC()
+	k1.NotAfter = time.Unix(1136300645, 0).UTC()
+	k2, _ := GenerateKey("k2", 16)
+	keys := []Key{k1, k2}
+
+	var buf bytes.Buffer
+	buf.WriteString("comment\n")
+	for _, k := range keys {
+		if err := WriteKeyPEM(&buf, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kr, err := ParseKeyRing(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParseKeyRing(pem) returned %v", err)
+	}
+	if !reflect.DeepEqual(kr.Keys(), keys) {
+		t.Errorf("ParseKeyRing(pem) = %v, want %v", kr.Keys(), keys)
+	}
+
+	p, err := MarshalKeysJSON(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kr, err = ParseKeyRing(p)
+	if err != nil {
+		t.Fatalf("ParseKeyRing(json) returned %v", err)
+	}
+	if !reflect.DeepEqual(kr.Keys(), keys) {
+		t.Errorf("ParseKeyRing(json) = %v, want %v", kr.Keys(), keys)
+	}
+
+	if _, err := ParseKeyRing([]byte("no keys")); err == nil {
+		t.Error("ParseKeyRing with no keys did not return error")
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"net/http"
+	"strings"
+)
+
+// parseCookies calls fn for each name-value pair in the Cookie request
+// headers in the order that the pairs appear. The parser follows the
+// algorithm in RFC 6265 section 5.4 for the cookie-string grammar: pairs are
+// separated by ';', whitespace around names and values is ignored and
+// pairs without '=' are skipped. Double quotes around a value are removed.
+func parseCookies(h http.Header, fn func(name, value string)) {
+	for _, line := range h["Cookie"] {
+		for len(line) > 0 {
+			var pair string
+			if i := strings.IndexByte(line, ';'); i >= 0 {
+				pair, line = line[:i], line[i+1:]
+			} else {
+				pair, line = line, ""
+			}
+			i := strings.IndexByte(pair, '=')
+			if i < 0 {
+				continue
+			}
+			name := strings.TrimSpace(pair[:i])
+			value := strings.TrimSpace(pair[i+1:])
+			if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+				value = value[1 : len(value)-1]
+			}
+			if name == "" || !isValidCookieValue(value) {
+				continue
+			}
+			fn(name, value)
+		}
+	}
+}
+
+// isValidCookieValue returns true if s is a sequence of cookie-octets as
+// defined in RFC 6265 section 4.1.1.
+func isValidCookieValue(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if b := s[i]; b <= ' ' || b >= 127 || b == '"' || b == ',' || b == ';' || b == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// Candidates returns the values of the cookies in the request with the
+// codec's name in the order that the cookies appear in the request. A request
+// can have more than one cookie with the same name when cookies are set with
+// different paths or domains. Decode uses the first candidate that passes the
+// signature, decryption and expiration checks. Candidates is useful for
+// debugging.
+//
+// If chunking is enabled, then the value assembled from the chunks is the
+// first candidate.
+func (cc *Codec) Candidates(r *http.Request) []string {
+	var candidates []string
+	if cc.chunkBudget > 0 {
+		if s, ok := cc.findChunks(r); ok {
+			candidates = append(candidates, s)
+		}
+	}
+	parseCookies(r.Header, func(name, value string) {
+		if name == cc.name && value != "" && value != "." {
+			candidates = append(candidates, value)
+		}
+	})
+	return candidates
+}
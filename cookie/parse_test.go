@@ -0,0 +1,77 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var parseCookiesTests = []struct {
+	h    []string
+	want []string
+}{
+	{[]string{"a=1"}, []string{"a=1"}},
+	{[]string{"a=1; b=2"}, []string{"a=1", "b=2"}},
+	{[]string{"a=1;b=2 ;  c = 3 "}, []string{"a=1", "b=2", "c=3"}},
+	{[]string{`a="1"; b=""`}, []string{"a=1", "b="}},
+	{[]string{"x; a=1; =2; ;"}, []string{"a=1"}},
+	{[]string{"a=1,2; b=x y; c=3"}, []string{"c=3"}},
+	{[]string{"a=1", "a=2"}, []string{"a=1", "a=2"}},
+	{[]string{"a=b=c"}, []string{"a=b=c"}},
+}
+
+func TestParseCookies(t *testing.T) {
+	for _, tt := range parseCookiesTests {
+		var got []string
+		parseCookies(http.Header{"Cookie": tt.h}, func(name, value string) {
+			got = append(got, name+"="+value)
+		})
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCookies(%q) = %q, want %q", tt.h, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeShadowed(t *testing.T) {
+	testTime := time.Unix(1136214245, 0)
+	now = func() time.Time { return testTime }
+	defer func() { now = time.Now }()
+
+	keys := [][]byte{[]byte("key")}
+	codec := NewCodec("c", WithHMACKeys(keys), WithMaxAge(time.Hour))
+	other := NewCodec("c", WithHMACKeys([][]byte{[]byte("other")}))
+
+	encode := func(cc *Codec, value string) string {
+		w := httptest.NewRecorder()
+		cc.Encode(w, value)
+		h := w.Header().Get("Set-Cookie")
+		return h[:strings.IndexByte(h, ';')]
+	}
+
+	valid := encode(codec, "valid")
+	forged := encode(other, "forged")
+	now = func() time.Time { return testTime.Add(-2 * time.Hour) }
+	expired := encode(codec, "expired")
+	now = func() time.Time { return testTime }
+
+	r := &http.Request{Header: http.Header{"Cookie": {forged + "; " + expired + "; x=y; " + valid}}}
+	var s string
+	if err := codec.Decode(r, &s); err != nil || s != "valid" {
+		t.Errorf("Decode() = %q, %v, want valid", s, err)
+	}
+	if got := codec.Candidates(r); len(got) != 3 || "c="+got[2] != valid {
+		t.Errorf("Candidates() = %q", got)
+	}
+
+	r = &http.Request{Header: http.Header{"Cookie": {forged + "; " + expired}}}
+	if err := codec.Decode(r, &s); err == nil || !strings.Contains(err.Error(), "HMAC") {
+		t.Errorf("Decode() of invalid cookies returned %v, want HMAC error", err)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"errors"
+	"time"
+)
+
+// TokenCodec encodes and decodes values to signed or encrypted tokens for use
+// in URL query parameters and path segments. Tokens use the same signing,
+// encryption, key rotation and value encoding as cookie values. Use tokens
+// for download links, email confirmation links and similar.
+type TokenCodec struct {
+	cc *Codec
+}
+
+// NewTokenCodec creates a token codec for the given purpose. The purpose is
+// bound to the token signature or encryption so that a token encoded for one
+// purpose is not accepted by a codec for another purpose or by a cookie
+// codec. The options WithHMACKeys, WithKeyRing, WithEncryptionKeys, WithAEAD,
+// WithHashFunc, WithMaxAge, WithAbsoluteLifetime, WithCompression, WithJWS
+// and WithTamperHook apply to tokens. Other options are ignored. NewTokenCodec
+// panics if the options do not specify signing or encryption keys.
+func NewTokenCodec(purpose string, options ...Option) *TokenCodec {
+	cc := newCodec("token:"+purpose, options)
+	if cc.hmacKeys == nil && cc.keyRing == nil && cc.aeads == nil {
+		panic("cookie: token codec requires signing or encryption keys")
+	}
+	// Tokens were never issued in the legacy format.
+	cc.legacyUntil = &time.Time{}
+	return &TokenCodec{cc: cc}
+}
+
+// Encode encodes values to a URL-safe token. The token contains only ASCII
+// letters, digits, '-', '_', '.' and '~'.
+func (tc *TokenCodec) Encode(values ...interface{}) (string, error) {
+	if len(values) == 0 {
+		return "", errors.New("cookie: token requires a value")
+	}
+	buf, err := tc.cc.encodeValue(time.Time{}, values)
+	if err != nil {
+		return "", err
+	}
+	if buf[0] == encryptedPrefix || tc.cc.jwsAlg != "" {
+		return string(buf), nil
+	}
+	return base64Encoding.EncodeToString(buf), nil
+}
+
+// Decode decodes values from a token.
+func (tc *TokenCodec) Decode(token string, values ...interface{}) error {
+	_, err := tc.decode(token, values)
+	return err
+}
+
+// DecodeTime decodes values from a token and returns the time that the token
+// was issued.
+func (tc *TokenCodec) DecodeTime(token string, values ...interface{}) (time.Time, error) {
+	d, err := tc.decode(token, values)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return d.issued, nil
+}
+
+func (tc *TokenCodec) decode(token string, values []interface{}) (*decoded, error) {
+	if token == "" {
+		return tc.cc.decodeCandidates(nil, values)
+	}
+	s := token
+	if token[0] != encryptedPrefix && tc.cc.jwsAlg == "" {
+		p, err := base64Encoding.DecodeString(token)
+		if err != nil || len(p) == 0 {
+			err := tc.cc.decodeError(ErrMalformed, "bad token format")
+			if tc.cc.tamperHook != nil {
+				tc.cc.tamperHook(err)
+			}
+			return nil, err
+		}
+		s = string(p)
+	}
+	return tc.cc.decodeCandidates([]string{s}, values)
+}
@@ -0,0 +1,83 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+var tokenKeyRing, _ = NewKeyRing(Key{ID: "k1", Secret: []byte("0123456789abcdef")})
+
+var tokenOptionTests = []struct {
+	name    string
+	options []Option
+}{
+	{"hmac", []Option{WithHMACKeys([][]byte{[]byte("key")})}},
+	{"keyring", []Option{WithKeyRing(tokenKeyRing)}},
+	{"encrypted", []Option{WithEncryptionKeys([][]byte{[]byte("0123456789abcdef")})}},
+}
+
+func TestTokenCodec(t *testing.T) {
+	t0 := time.Unix(1136214245, 0)
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+
+	for _, tt := range tokenOptionTests {
+		tc := NewTokenCodec("download", append(tt.options, WithMaxAge(time.Hour))...)
+		token, err := tc.Encode("file/a b|c.txt", 42)
+		if err != nil {
+			t.Errorf("%s: Encode() returned %v", tt.name, err)
+			continue
+		}
+		if url.PathEscape(token) != token || url.QueryEscape(token) != token {
+			t.Errorf("%s: token %q is not URL-safe", tt.name, token)
+		}
+
+		var s string
+		var n int
+		issued, err := tc.DecodeTime(token, &s, &n)
+		if err != nil || s != "file/a b|c.txt" || n != 42 || !issued.Equal(t0) {
+			t.Errorf("%s: DecodeTime() = %q, %d, %v, %v", tt.name, s, n, issued, err)
+		}
+
+		// A token for one purpose is not valid for another purpose.
+		other := NewTokenCodec("confirm", tt.options...)
+		if err := other.Decode(token, &s); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: Decode(other purpose) returned %v, want ErrInvalid", tt.name, err)
+		}
+
+		if err := tc.Decode(token[:len(token)-2], &s); err == nil {
+			t.Errorf("%s: Decode(truncated) did not return error", tt.name)
+		}
+		if err := tc.Decode("", &s); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: Decode(\"\") returned %v, want ErrNotFound", tt.name, err)
+		}
+
+		t0 = t0.Add(2 * time.Hour)
+		if err := tc.Decode(token, &s); !errors.Is(err, ErrExpired) {
+			t.Errorf("%s: Decode(expired) returned %v, want ErrExpired", tt.name, err)
+		}
+		t0 = t0.Add(-2 * time.Hour)
+	}
+}
+
+func TestTokenNotCookie(t *testing.T) {
+	keys := WithHMACKeys([][]byte{[]byte("key")})
+	cc := NewCodec("download", keys)
+	tc := NewTokenCodec("download", keys)
+	token, _ := tc.Encode("x")
+	p, _ := base64Encoding.DecodeString(token)
+	var s string
+	if err := cc.DecodeString(string(p), &s); err == nil {
+		t.Error("cookie codec accepted token")
+	}
+	v := encodeSetCookie(t, cc, "x")[len("download="):]
+	if err := tc.Decode(base64Encoding.EncodeToString([]byte(v)), &s); err == nil {
+		t.Error("token codec accepted cookie value")
+	}
+}
@@ -0,0 +1,493 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookie
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Values are encoded as follows:
+//
+//  string, TextMarshaler  percent encoded text
+//  int, int64, ...        base 36
+//  uint, uint64, ...      base 36
+//  bool                   "1" or "0"
+//  float32, float64       decimal without '+'
+//  time.Time              base 36 Unix seconds, optional '.' and base 36 nanoseconds
+//  time.Duration          base 36 nanoseconds
+//  []byte                 unpadded base64url
+//  slice, array           elements separated by '!'
+//  struct, map            format version "1" followed by '!' separated name=value pairs
+//
+// Elements and name=value pairs that are themselves slices, arrays, structs or
+// maps are nested by percent encoding the '%', '!' and '=' bytes.
+//
+// Struct fields are named by the cookie: field tag. The format is:
+//
+//  `cookie:"name,omitempty"`
+//
+// If the name is blank, then the field name is used. A name of "-" skips the
+// field. The omitempty option omits fields with the zero value. Fields missing
+// from the encoded value are left unchanged by the decoder and unknown names
+// are ignored, so fields can be added to and removed from a struct without
+// invalidating existing cookies.
+
+// structFormatVersion is the format version for structs and maps.
+const structFormatVersion = "1"
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// encodeBytes percent encodes bytes not allowed in cookie values, bytes used
+// in percent encodings and delimiters used in this package.
+func encodeBytes(buf []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch {
+		case b == ' ':
+			buf = append(buf, '+')
+		case // byte values not allowed in cookie value
+			b <= ' ' ||
+				b >= 127 ||
+				b == '"' ||
+				b == ',' ||
+				b == ';' ||
+				b == '\\' ||
+				// byte values with special meaning in percent encoding
+				b == '+' ||
+				b == '%' ||
+				// value deliminter
+				b == '|' ||
+				// string slice delimiter
+				b == '!':
+			buf = append(buf, '%', "0123456789ABCDEF"[b>>4], "0123456789ABCDEF"[b&15])
+		default:
+			buf = append(buf, b)
+		}
+	}
+	return buf
+}
+
+// encodeNested percent encodes the delimiters in an encoded composite value
+// so that the value can be nested in another composite value.
+func encodeNested(buf []byte, p []byte) []byte {
+	for _, b := range p {
+		switch b {
+		case '%', '!', '=':
+			buf = append(buf, '%', "0123456789ABCDEF"[b>>4], "0123456789ABCDEF"[b&15])
+		default:
+			buf = append(buf, b)
+		}
+	}
+	return buf
+}
+
+func split(s string) (string, string) {
+	if i := strings.IndexByte(s, '|'); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+func encodeValues(buf []byte, values []interface{}) ([]byte, error) {
+	for i, v := range values {
+		if i != 0 {
+			buf = append(buf, '|')
+		}
+		if v == nil {
+			continue
+		}
+		var err error
+		buf, err = encodeValue(buf, reflect.ValueOf(v))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func decodeValues(s string, values []interface{}) error {
+	for len(s) > 0 && len(values) > 0 {
+		var p string
+		p, s = split(s)
+		if v := values[0]; v != nil {
+			rv := reflect.ValueOf(v)
+			if rv.Kind() != reflect.Ptr || rv.IsNil() {
+				return fmt.Errorf("cookie: value type %s not supported", rv.Type())
+			}
+			if err := decodeValue(p, rv.Elem()); err != nil {
+				return err
+			}
+		}
+		values = values[1:]
+	}
+	return nil
+}
+
+// isComposite returns true if values of type t are encoded with delimiters.
+func isComposite(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType || t.Implements(textMarshalerType) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Uint8
+	case reflect.Array, reflect.Struct, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// encodeElement encodes an element of a composite value.
+func encodeElement(buf []byte, v reflect.Value) ([]byte, error) {
+	if !isComposite(v.Type()) {
+		return encodeValue(buf, v)
+	}
+	p, err := encodeValue(nil, v)
+	if err != nil {
+		return nil, err
+	}
+	return encodeNested(buf, p), nil
+}
+
+// decodeElement decodes an element of a composite value.
+func decodeElement(s string, v reflect.Value) error {
+	if isComposite(v.Type()) {
+		var err error
+		s, err = url.PathUnescape(s)
+		if err != nil {
+			return err
+		}
+	}
+	return decodeValue(s, v)
+}
+
+func encodeValue(buf []byte, v reflect.Value) ([]byte, error) {
+	t := v.Type()
+	if t == timeType {
+		tm := v.Interface().(time.Time)
+		if tm.IsZero() {
+			return buf, nil
+		}
+		buf = strconv.AppendInt(buf, tm.Unix(), 36)
+		if ns := tm.Nanosecond(); ns != 0 {
+			buf = append(buf, '.')
+			buf = strconv.AppendInt(buf, int64(ns), 36)
+		}
+		return buf, nil
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		if !t.Implements(textMarshalerType) {
+			pv := reflect.New(t)
+			pv.Elem().Set(v)
+			v = pv
+		}
+		p, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return encodeBytes(buf, string(p)), nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return encodeBytes(buf, v.String()), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, '1'), nil
+		}
+		return append(buf, '0'), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(buf, v.Int(), 36), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.AppendUint(buf, v.Uint(), 36), nil
+	case reflect.Float32, reflect.Float64:
+		s := strconv.FormatFloat(v.Float(), 'g', -1, t.Bits())
+		return append(buf, strings.Replace(s, "+", "", -1)...), nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, errors.New("cookie: nil pointer value")
+		}
+		return encodeValue(buf, v.Elem())
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			p := v.Bytes()
+			n := len(buf)
+			buf = append(buf, make([]byte, base64Encoding.EncodedLen(len(p)))...)
+			base64Encoding.Encode(buf[n:], p)
+			return buf, nil
+		}
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if i != 0 {
+				buf = append(buf, '!')
+			}
+			var err error
+			buf, err = encodeElement(buf, v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case reflect.Map:
+		buf = append(buf, structFormatVersion...)
+		type entry struct{ k, v []byte }
+		var entries []entry
+		iter := v.MapRange()
+		for iter.Next() {
+			k, err := encodeElement(nil, iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			e, err := encodeElement(nil, iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry{encodeNested(nil, k), e})
+		}
+		sort.Slice(entries, func(i, j int) bool { return string(entries[i].k) < string(entries[j].k) })
+		for _, e := range entries {
+			buf = append(buf, '!')
+			buf = append(buf, e.k...)
+			buf = append(buf, '=')
+			buf = append(buf, e.v...)
+		}
+		return buf, nil
+	case reflect.Struct:
+		buf = append(buf, structFormatVersion...)
+		for _, f := range structFields(t) {
+			fv := v.FieldByIndex(f.index)
+			if f.omitEmpty && fv.IsZero() {
+				continue
+			}
+			buf = append(buf, '!')
+			buf = encodeNested(buf, []byte(f.name))
+			buf = append(buf, '=')
+			var err error
+			buf, err = encodeElement(buf, fv)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("cookie: value type %s not supported", t)
+}
+
+func decodeValue(s string, v reflect.Value) error {
+	t := v.Type()
+	if t == timeType {
+		if s == "" {
+			v.Set(reflect.ValueOf(time.Time{}))
+			return nil
+		}
+		sec, nsec := s, ""
+		if i := strings.IndexByte(s, '.'); i >= 0 {
+			sec, nsec = s[:i], s[i+1:]
+		}
+		n, err := strconv.ParseInt(sec, 36, 64)
+		if err != nil {
+			return err
+		}
+		var ns int64
+		if nsec != "" {
+			ns, err = strconv.ParseInt(nsec, 36, 64)
+			if err != nil {
+				return err
+			}
+		}
+		v.Set(reflect.ValueOf(time.Unix(n, ns).UTC()))
+		return nil
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		p, err := url.QueryUnescape(s)
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(p))
+	}
+	switch t.Kind() {
+	case reflect.String:
+		p, err := url.QueryUnescape(s)
+		if err != nil {
+			return err
+		}
+		v.SetString(p)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 36, t.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 36, t.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return decodeValue(s, v.Elem())
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			p, err := base64Encoding.DecodeString(s)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(p)
+			return nil
+		}
+		if s == "" {
+			return nil
+		}
+		for _, q := range strings.Split(s, "!") {
+			ev := reflect.New(t.Elem()).Elem()
+			if err := decodeElement(q, ev); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, ev))
+		}
+		return nil
+	case reflect.Array:
+		if s == "" {
+			return nil
+		}
+		for i, q := range strings.Split(s, "!") {
+			if i >= v.Len() {
+				break
+			}
+			if err := decodeElement(q, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		pairs, err := splitPairs(s)
+		if err != nil {
+			return err
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(t))
+		}
+		for _, pair := range pairs {
+			kv := reflect.New(t.Key()).Elem()
+			if err := decodeElement(pair[0], kv); err != nil {
+				return err
+			}
+			ev := reflect.New(t.Elem()).Elem()
+			if err := decodeElement(pair[1], ev); err != nil {
+				return err
+			}
+			v.SetMapIndex(kv, ev)
+		}
+		return nil
+	case reflect.Struct:
+		pairs, err := splitPairs(s)
+		if err != nil {
+			return err
+		}
+		fields := structFields(t)
+		for _, pair := range pairs {
+			for _, f := range fields {
+				if f.name == pair[0] {
+					if err := decodeElement(pair[1], v.FieldByIndex(f.index)); err != nil {
+						return err
+					}
+					break
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("cookie: value type %s not supported", t)
+}
+
+var errBadStructFormat = errors.New("cookie: bad struct or map format")
+
+// splitPairs splits an encoded struct or map to name=value pairs. The names
+// are unescaped.
+func splitPairs(s string) ([][2]string, error) {
+	parts := strings.Split(s, "!")
+	if parts[0] != structFormatVersion {
+		return nil, errBadStructFormat
+	}
+	var pairs [][2]string
+	for _, part := range parts[1:] {
+		i := strings.IndexByte(part, '=')
+		if i < 0 {
+			return nil, errBadStructFormat
+		}
+		name, err := url.PathUnescape(part[:i])
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, [2]string{name, part[i+1:]})
+	}
+	return pairs, nil
+}
+
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// structFields returns the encoded fields of a struct type.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag := sf.Tag.Get("cookie")
+		if tag == "-" {
+			continue
+		}
+		f := structField{name: sf.Name, index: sf.Index}
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			f.omitEmpty = tag[i+1:] == "omitempty"
+			tag = tag[:i]
+		}
+		if tag != "" {
+			f.name = tag
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
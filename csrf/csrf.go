@@ -0,0 +1,320 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package csrf protects against cross-site request forgery.
+//
+// The protector stores a random secret for each client in a signed cookie
+// (the double-submit cookie pattern) or in the client's session (the
+// synchronizer token pattern). Handlers get a token for the secret from the
+// request context and include the token in forms or request headers. Each
+// call to Token returns a different token for the same secret to protect
+// against BREACH style attacks.
+//
+// Requests with unsafe methods must include a token that matches the secret
+// and an Origin or Referer header from the same origin as the request. The
+// Referer header is required for HTTPS requests without an Origin header.
+package csrf // import "github.com/garyburd/web/csrf"
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	htemp "html/template"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/garyburd/web/cookie"
+	"github.com/garyburd/web/httperror"
+	"github.com/garyburd/web/router"
+	"github.com/garyburd/web/session"
+	"golang.org/x/net/context"
+)
+
+const secretLen = 32
+
+var (
+	errBadOrigin  = errors.New("csrf: origin does not match")
+	errNoReferer  = errors.New("csrf: referer required for HTTPS")
+	errBadReferer = errors.New("csrf: referer does not match")
+	errBadToken   = errors.New("csrf: token does not match")
+)
+
+// secretStore loads and saves the secret for a client.
+type secretStore interface {
+	// load returns the secret for the request. If the request does not have
+	// a secret, then a new secret is created and saved.
+	load(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, []byte, error)
+}
+
+func newSecret() ([]byte, error) {
+	secret := make([]byte, secretLen)
+	_, err := io.ReadFull(rand.Reader, secret)
+	return secret, err
+}
+
+type cookieStore struct {
+	codec *cookie.Codec
+}
+
+func (cs cookieStore) load(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, []byte, error) {
+	var secret []byte
+	if err := cs.codec.Decode(r, &secret); err == nil && len(secret) == secretLen {
+		return ctx, secret, nil
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return ctx, nil, err
+	}
+	return ctx, secret, cs.codec.Encode(w, secret)
+}
+
+// sessionSecretKey is the session key for the secret.
+const sessionSecretKey = "csrf"
+
+type sessionStore struct {
+	m *session.Manager
+}
+
+func (ss sessionStore) load(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, []byte, error) {
+	s, ok := session.FromContext(ctx)
+	if !ok {
+		var err error
+		s, err = ss.m.Get(ctx, r)
+		if err != nil {
+			return ctx, nil, err
+		}
+		ctx = session.NewContext(ctx, s)
+	}
+	if v, ok := s.Get(sessionSecretKey); ok {
+		if secret, err := base64.RawURLEncoding.DecodeString(v); err == nil && len(secret) == secretLen {
+			return ctx, secret, nil
+		}
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return ctx, nil, err
+	}
+	s.Set(sessionSecretKey, base64.RawURLEncoding.EncodeToString(secret))
+	return ctx, secret, ss.m.Save(ctx, w, s)
+}
+
+// Protector protects handlers against cross-site request forgery.
+type Protector struct {
+	store        secretStore
+	fieldName    string
+	headerName   string
+	trusted      map[string]bool
+	errfn        router.ErrorFn
+	exemptRouter *router.Router
+	exempt       map[*router.Route]bool
+}
+
+// Option specifies an option for a protector.
+type Option struct {
+	f func(*Protector)
+}
+
+// WithFieldName sets the name of the form field containing the token. The
+// default name is "csrf_token".
+func WithFieldName(name string) Option {
+	return Option{func(p *Protector) { p.fieldName = name }}
+}
+
+// WithHeaderName sets the name of the request header containing the token.
+// The default name is "X-CSRF-Token".
+func WithHeaderName(name string) Option {
+	return Option{func(p *Protector) { p.headerName = name }}
+}
+
+// WithTrustedOrigins specifies origins, other than the origin of the request,
+// that are allowed to send requests with unsafe methods. An origin has the
+// form scheme://host[:port]. Use this option when the server is behind a
+// proxy that terminates TLS.
+func WithTrustedOrigins(origins ...string) Option {
+	return Option{func(p *Protector) {
+		for _, origin := range origins {
+			p.trusted[origin] = true
+		}
+	}}
+}
+
+// WithErrorFn sets the function used to generate error responses. The
+// function is called with status 403 and an error wrapping
+// httperror.ErrForbidden and the reason when a request is rejected. The
+// default error function calls the net/http Error function.
+func WithErrorFn(errfn router.ErrorFn) Option {
+	return Option{func(p *Protector) { p.errfn = errfn }}
+}
+
+func newProtector(store secretStore, options []Option) *Protector {
+	p := &Protector{
+		store:      store,
+		fieldName:  "csrf_token",
+		headerName: "X-CSRF-Token",
+		trusted:    make(map[string]bool),
+		errfn: func(ctx context.Context, w http.ResponseWriter, r *http.Request, status int, err error) {
+			http.Error(w, http.StatusText(status), status)
+		},
+		exempt: make(map[*router.Route]bool),
+	}
+	for _, option := range options {
+		option.f(p)
+	}
+	return p
+}
+
+// New returns a protector that stores the secret in a cookie using codec.
+// The codec must sign or encrypt the cookie.
+func New(codec *cookie.Codec, options ...Option) *Protector {
+	return newProtector(cookieStore{codec}, options)
+}
+
+// NewWithSession returns a protector that stores the secret in the session.
+// The protector stores the session in the request context. Handlers should
+// get the session using session.FromContext.
+func NewWithSession(m *session.Manager, options ...Option) *Protector {
+	return newProtector(sessionStore{m}, options)
+}
+
+// Exempt exempts the routes from checks. The router is used to find the route
+// for a request.
+func (p *Protector) Exempt(rt *router.Router, routes ...*router.Route) {
+	p.exemptRouter = rt
+	for _, route := range routes {
+		p.exempt[route] = true
+	}
+}
+
+func (p *Protector) isExempt(r *http.Request) bool {
+	if p.exemptRouter == nil {
+		return false
+	}
+	route, _, status := p.exemptRouter.Resolve(r)
+	return status == http.StatusOK && p.exempt[route]
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+func requestOrigin(r *http.Request) string {
+	if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+// checkOrigin checks the Origin and Referer headers.
+func (p *Protector) checkOrigin(r *http.Request) error {
+	origin := requestOrigin(r)
+	if o := r.Header.Get("Origin"); o != "" {
+		if o != origin && !p.trusted[o] {
+			return errBadOrigin
+		}
+		return nil
+	}
+	if r.TLS == nil {
+		return nil
+	}
+	referer := r.Header.Get("Referer")
+	if referer == "" {
+		return errNoReferer
+	}
+	u, err := url.Parse(referer)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errBadReferer
+	}
+	if o := u.Scheme + "://" + u.Host; o != origin && !p.trusted[o] {
+		return errBadReferer
+	}
+	return nil
+}
+
+// checkToken checks the token in the request header or form.
+func (p *Protector) checkToken(r *http.Request, secret []byte) error {
+	token := r.Header.Get(p.headerName)
+	if token == "" {
+		token = r.PostFormValue(p.fieldName)
+	}
+	masked, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(masked) != 2*secretLen {
+		return errBadToken
+	}
+	for i := 0; i < secretLen; i++ {
+		masked[secretLen+i] ^= masked[i]
+	}
+	if subtle.ConstantTimeCompare(masked[secretLen:], secret) != 1 {
+		return errBadToken
+	}
+	return nil
+}
+
+type tokenKey struct{}
+
+type tokenInfo struct {
+	secret []byte
+}
+
+// Handler returns a handler that checks the request and calls h. Requests
+// with unsafe methods are rejected unless the request has a valid token and
+// origin or the request matches an exempt route.
+func (p *Protector) Handler(h router.Handler) router.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		ctx, secret, err := p.store.load(ctx, w, r)
+		if err != nil {
+			p.errfn(ctx, w, r, http.StatusInternalServerError, err)
+			return
+		}
+		if !isSafeMethod(r.Method) && !p.isExempt(r) {
+			err := p.checkOrigin(r)
+			if err == nil {
+				err = p.checkToken(r, secret)
+			}
+			if err != nil {
+				p.errfn(ctx, w, r, http.StatusForbidden, fmt.Errorf("%w: %w", httperror.ErrForbidden, err))
+				return
+			}
+		}
+		h(context.WithValue(ctx, tokenKey{}, &tokenInfo{secret: secret}), w, r)
+	}
+}
+
+// Token returns a token for the request. The token is different on each
+// call. Token returns "" if the context is not from a protector handler.
+func Token(ctx context.Context) string {
+	ti, ok := ctx.Value(tokenKey{}).(*tokenInfo)
+	if !ok {
+		return ""
+	}
+	masked := make([]byte, 2*secretLen)
+	if _, err := io.ReadFull(rand.Reader, masked[:secretLen]); err != nil {
+		return ""
+	}
+	for i := 0; i < secretLen; i++ {
+		masked[secretLen+i] = masked[i] ^ ti.secret[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// TemplateFuncs returns template functions for the protector. The function
+// csrfField returns a hidden input element for a token:
+//
+//	<form method="POST">{{csrfField .CSRFToken}}...</form>
+//
+// Add the functions to the template manager's HTMLFuncs.
+func (p *Protector) TemplateFuncs() map[string]interface{} {
+	name := htemp.HTMLEscapeString(p.fieldName)
+	return map[string]interface{}{
+		"csrfField": func(token string) htemp.HTML {
+			return htemp.HTML(`<input type="hidden" name="` + name + `" value="` + htemp.HTMLEscapeString(token) + `">`)
+		},
+	}
+}
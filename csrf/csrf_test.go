@@ -0,0 +1,179 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csrf
+
+import (
+	"crypto/tls"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/garyburd/web/cookie"
+	"github.com/garyburd/web/httperror"
+	"github.com/garyburd/web/router"
+	"github.com/garyburd/web/session"
+	"golang.org/x/net/context"
+)
+
+func tokenHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, Token(ctx))
+}
+
+type testServer struct {
+	handler router.Handler
+	errs    []error
+}
+
+func newTestServer(newProtector func(options ...Option) *Protector) *testServer {
+	ts := &testServer{}
+	rt := router.New()
+	rt.Add("/form").Get(tokenHandler).Post(tokenHandler)
+	hook := rt.Add("/hook").Post(tokenHandler)
+	p := newProtector(
+		WithTrustedOrigins("https://trusted.example.com"),
+		WithErrorFn(func(ctx context.Context, w http.ResponseWriter, r *http.Request, status int, err error) {
+			ts.errs = append(ts.errs, err)
+			http.Error(w, http.StatusText(status), status)
+		}))
+	p.Exempt(rt, hook)
+	ts.handler = p.Handler(rt.Serve)
+	return ts
+}
+
+func (ts *testServer) do(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ts.handler(context.Background(), w, r)
+	return w
+}
+
+func setCookieToCookie(h string) string {
+	if i := strings.IndexByte(h, ';'); i >= 0 {
+		h = h[:i]
+	}
+	return h
+}
+
+var csrfTests = []struct {
+	desc   string
+	path   string
+	tls    bool
+	origin string
+	ref    string
+	field  bool
+	header bool
+	bad    bool
+	status int
+}{
+	{desc: "form token", path: "/form", field: true, status: 200},
+	{desc: "header token", path: "/form", header: true, status: 200},
+	{desc: "no token", path: "/form", status: 403},
+	{desc: "bad token", path: "/form", field: true, bad: true, status: 403},
+	{desc: "same origin", path: "/form", origin: "http://example.com", field: true, status: 200},
+	{desc: "cross origin", path: "/form", origin: "http://evil.com", field: true, status: 403},
+	{desc: "null origin", path: "/form", origin: "null", field: true, status: 403},
+	{desc: "https origin", path: "/form", tls: true, origin: "https://example.com", field: true, status: 200},
+	{desc: "https trusted origin", path: "/form", tls: true, origin: "https://trusted.example.com", field: true, status: 200},
+	{desc: "https downgraded origin", path: "/form", tls: true, origin: "http://example.com", field: true, status: 403},
+	{desc: "https referer", path: "/form", tls: true, ref: "https://example.com/form", field: true, status: 200},
+	{desc: "https cross referer", path: "/form", tls: true, ref: "https://evil.com/form", field: true, status: 403},
+	{desc: "https no referer", path: "/form", tls: true, field: true, status: 403},
+	{desc: "exempt", path: "/hook", origin: "http://evil.com", status: 200},
+}
+
+func testProtector(t *testing.T, newProtector func(options ...Option) *Protector) {
+	ts := newTestServer(newProtector)
+
+	w := ts.do(httptest.NewRequest("GET", "/form", nil))
+	if w.Code != 200 {
+		t.Fatalf("GET status = %d, want 200", w.Code)
+	}
+	c := setCookieToCookie(w.Header().Get("Set-Cookie"))
+	token := w.Body.String()
+	if c == "" || token == "" {
+		t.Fatalf("GET did not return cookie and token")
+	}
+
+	// The token changes on each request, but the secret does not.
+	r := httptest.NewRequest("GET", "/form", nil)
+	r.Header.Set("Cookie", c)
+	w = ts.do(r)
+	if w.Body.String() == token {
+		t.Errorf("token did not change between requests")
+	}
+	if h := w.Header().Get("Set-Cookie"); h != "" {
+		t.Errorf("second GET set cookie %q", h)
+	}
+
+	for _, tt := range csrfTests {
+		tok := token
+		if tt.bad {
+			tok = strings.Repeat("A", len(token))
+		}
+		form := url.Values{}
+		if tt.field {
+			form.Set("csrf_token", tok)
+		}
+		r := httptest.NewRequest("POST", tt.path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Cookie", c)
+		if tt.header {
+			r.Header.Set("X-CSRF-Token", tok)
+		}
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.ref != "" {
+			r.Header.Set("Referer", tt.ref)
+		}
+		ts.errs = nil
+		w := ts.do(r)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.desc, w.Code, tt.status)
+		}
+		if tt.status == http.StatusForbidden {
+			if len(ts.errs) != 1 || !errors.Is(ts.errs[0], httperror.ErrForbidden) || httperror.Convert(ts.errs[0]).Status != http.StatusForbidden {
+				t.Errorf("%s: errors = %v, want forbidden", tt.desc, ts.errs)
+			}
+		}
+	}
+
+	// A token from another client is rejected.
+	w = ts.do(httptest.NewRequest("GET", "/form", nil))
+	form := url.Values{"csrf_token": {w.Body.String()}}
+	r = httptest.NewRequest("POST", "/form", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Cookie", c)
+	if w := ts.do(r); w.Code != http.StatusForbidden {
+		t.Errorf("token from other client: status = %d, want 403", w.Code)
+	}
+}
+
+func TestCookieProtector(t *testing.T) {
+	codec := cookie.NewCodec("csrf", cookie.WithHMACKeys([][]byte{[]byte("key")}))
+	testProtector(t, func(options ...Option) *Protector { return New(codec, options...) })
+}
+
+func TestSessionProtector(t *testing.T) {
+	codec := cookie.NewCodec("session", cookie.WithHMACKeys([][]byte{[]byte("key")}))
+	m := session.NewManager(codec, session.NewMemoryStore())
+	testProtector(t, func(options ...Option) *Protector { return NewWithSession(m, options...) })
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	p := New(cookie.NewCodec("csrf"), WithFieldName("a&b"))
+	fn := p.TemplateFuncs()["csrfField"].(func(string) template.HTML)
+	const want = `<input type="hidden" name="a&amp;b" value="xyz">`
+	if got := string(fn("xyz")); got != want {
+		t.Errorf("csrfField() = %s, want %s", got, want)
+	}
+}
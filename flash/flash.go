@@ -0,0 +1,177 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package flash implements one-time messages for post/redirect/get flows.
+//
+// Each message is stored in a separate cookie encoded by a cookie.Codec. The
+// cookie name is the flash name followed by '.' and a unique ID. Because
+// messages do not share a cookie, messages queued by concurrent requests from
+// different browser tabs are not lost, and reading the messages deletes only
+// the cookies that were read.
+//
+// Pass the messages to a template as part of the template data and render the
+// messages with the functions from the TemplateFuncs method.
+package flash // import "github.com/garyburd/web/flash"
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	htemp "html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/web/cookie"
+)
+
+// now is a hook for tests.
+var now = time.Now
+
+// Level is the level of a message.
+type Level int
+
+const (
+	Info Level = iota
+	Success
+	Warning
+	Error
+)
+
+var levelNames = []string{"info", "success", "warning", "error"}
+
+// String returns the lowercase name of the level. The name is suitable for use
+// as a CSS class name.
+func (l Level) String() string {
+	if 0 <= l && int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return "level" + strconv.Itoa(int(l))
+}
+
+// Message is a flash message.
+type Message struct {
+	Level Level
+	Text  string
+}
+
+// Messages is a list of messages in the order that the messages were added.
+type Messages []Message
+
+// Level returns the messages with the given level name.
+func (ms Messages) Level(name string) Messages {
+	var result Messages
+	for _, m := range ms {
+		if m.Level.String() == name {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// Flash reads and writes flash messages.
+type Flash struct {
+	name        string
+	codec       *cookie.Codec
+	maxMessages int
+}
+
+// New returns a flash using cookies with the given name prefix. The options
+// are used to create the codec for the message cookies. Include HMAC or
+// encryption keys in the options to prevent forged messages. New panics if
+// the name or options are not valid.
+func New(name string, options ...cookie.Option) *Flash {
+	return &Flash{name: name, codec: cookie.NewCodec(name+".0", options...), maxMessages: 20}
+}
+
+// messageCodec returns the codec for the message cookie with the given name.
+func (f *Flash) messageCodec(name string) *cookie.Codec {
+	return f.codec.Rename(name)
+}
+
+func newID() (string, error) {
+	var p [4]byte
+	if _, err := rand.Read(p[:]); err != nil {
+		return "", err
+	}
+	// The time prefix orders the messages. The random suffix prevents
+	// collisions between concurrent requests.
+	return strconv.FormatInt(now().UnixNano(), 36) + hex.EncodeToString(p[:]), nil
+}
+
+func isValidID(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if b := s[i]; !('0' <= b && b <= '9' || 'a' <= b && b <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// Add queues a message for the next request.
+func (f *Flash) Add(w http.ResponseWriter, level Level, text string) error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	return f.messageCodec(f.name+"."+id).Encode(w, int(level), text)
+}
+
+// Get returns the messages queued for the request and deletes the cookies
+// for the messages. Invalid message cookies are ignored and deleted. Call Get
+// before writing the response body.
+func (f *Flash) Get(w http.ResponseWriter, r *http.Request) (Messages, error) {
+	prefix := f.name + "."
+	var names []string
+	seen := make(map[string]bool)
+	for _, c := range r.Cookies() {
+		if strings.HasPrefix(c.Name, prefix) && isValidID(c.Name[len(prefix):]) && !seen[c.Name] {
+			seen[c.Name] = true
+			names = append(names, c.Name)
+		}
+	}
+	sort.Strings(names)
+	var messages Messages
+	for i, name := range names {
+		codec := f.messageCodec(name)
+		if i >= len(names)-f.maxMessages {
+			var level int
+			var text string
+			if err := codec.Decode(r, &level, &text); err == nil {
+				messages = append(messages, Message{Level: Level(level), Text: text})
+			}
+		}
+		if err := codec.Encode(w); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+// TemplateFuncs returns template functions for flash messages. The function
+// flashMessages returns a div element for each message with the classes
+// "flash" and "flash-" followed by the level name:
+//
+//	{{flashMessages .Flash}}
+//
+// Add the functions to the template manager's HTMLFuncs.
+func (f *Flash) TemplateFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"flashMessages": func(messages Messages) htemp.HTML {
+			var buf []byte
+			for _, m := range messages {
+				buf = append(buf, `<div class="flash flash-`...)
+				buf = append(buf, htemp.HTMLEscapeString(m.Level.String())...)
+				buf = append(buf, `">`...)
+				buf = append(buf, htemp.HTMLEscapeString(m.Text)...)
+				buf = append(buf, `</div>`...)
+			}
+			return htemp.HTML(buf)
+		},
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flash
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garyburd/web/cookie"
+	"github.com/garyburd/web/templates"
+)
+
+// jar stores cookies like a browser.
+type jar map[string]string
+
+func (j jar) update(w *httptest.ResponseRecorder) {
+	for _, h := range w.Header()["Set-Cookie"] {
+		nv := h[:strings.IndexByte(h, ';')]
+		i := strings.IndexByte(nv, '=')
+		if strings.Contains(h, "max-age=-") {
+			delete(j, nv[:i])
+		} else {
+			j[nv[:i]] = nv[i+1:]
+		}
+	}
+}
+
+func (j jar) request() *http.Request {
+	var pairs []string
+	for name, value := range j {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return &http.Request{Header: http.Header{"Cookie": {strings.Join(pairs, "; ")}}}
+}
+
+func TestFlash(t *testing.T) {
+	t0 := time.Unix(1136214245, 0)
+	now = func() time.Time { t0 = t0.Add(time.Millisecond); return t0 }
+	defer func() { now = time.Now }()
+
+	f := New("flash", cookie.WithHMACKeys([][]byte{[]byte("key")}))
+	j := jar{}
+
+	// Messages added by concurrent requests from different tabs.
+	w1 := httptest.NewRecorder()
+	w2 := httptest.NewRecorder()
+	if err := f.Add(w1, Success, "Saved."); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Add(w2, Error, "Not saved."); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Add(w2, Info, "<b>"); err != nil {
+		t.Fatal(err)
+	}
+	j.update(w1)
+	j.update(w2)
+
+	// Forged and unrelated cookies.
+	j["flash.zzz"] = "forged"
+	j["other"] = "value"
+
+	w := httptest.NewRecorder()
+	messages, err := f.Get(w, j.request())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Messages{{Success, "Saved."}, {Error, "Not saved."}, {Info, "<b>"}}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("Get() = %v, want %v", messages, want)
+	}
+	if got := messages.Level("error"); !reflect.DeepEqual(got, Messages{{Error, "Not saved."}}) {
+		t.Errorf("Level(error) = %v", got)
+	}
+	j.update(w)
+	if len(j) != 1 {
+		t.Errorf("cookies after Get = %v, want other", j)
+	}
+
+	w = httptest.NewRecorder()
+	messages, _ = f.Get(w, j.request())
+	if len(messages) != 0 {
+		t.Errorf("second Get() = %v, want none", messages)
+	}
+
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	t0 := time.Unix(1136214245, 0)
+	now = func() time.Time { t0 = t0.Add(time.Millisecond); return t0 }
+	defer func() { now = time.Now }()
+
+	dir, err := ioutil.TempDir("", "flash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const text = `{{define "ROOT"}}<body>{{flashMessages .Flash}}</body>{{end}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "page.html"), []byte(text), 0666); err != nil {
+		t.Fatal(err)
+	}
+	f := New("flash", cookie.WithHMACKeys([][]byte{[]byte("key")}))
+	m := templates.Manager{HTMLFuncs: f.TemplateFuncs()}
+	page := m.NewHTML("page.html")
+	if err := m.Load(dir, true); err != nil {
+		t.Fatal(err)
+	}
+
+	j := jar{}
+	w := httptest.NewRecorder()
+	f.Add(w, Success, "Saved.")
+	f.Add(w, Error, "<b>")
+	j.update(w)
+	messages, err := f.Get(httptest.NewRecorder(), j.request())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, map[string]interface{}{"Flash": messages}); err != nil {
+		t.Fatal(err)
+	}
+	const html = `<body><div class="flash flash-success">Saved.</div><div class="flash flash-error">&lt;b&gt;</div></body>`
+	if buf.String() != html {
+		t.Errorf("template output = %s, want %s", buf.String(), html)
+	}
+}
@@ -230,7 +230,8 @@ type AcceptSpec struct {
 	Q     float64
 }
 
-// ParseAccept parses Accept* headers.
+// ParseAccept parses Accept* headers. Media type parameters preceding the
+// quality parameter are skipped.
 func ParseAccept(header http.Header, key string) (specs []AcceptSpec) {
 loop:
 	for _, s := range header[key] {
@@ -242,15 +243,25 @@ loop:
 			}
 			spec.Q = 1.0
 			s = skipSpace(s)
-			if strings.HasPrefix(s, ";") {
+			for strings.HasPrefix(s, ";") {
 				s = skipSpace(s[1:])
-				if !strings.HasPrefix(s, "q=") {
+				if strings.HasPrefix(s, "q=") {
+					spec.Q, s = expectQuality(s[2:])
+					if spec.Q < 0.0 {
+						continue loop
+					}
+					break
+				}
+				var pkey, pvalue string
+				pkey, s = expectToken(s)
+				if pkey == "" || !strings.HasPrefix(s, "=") {
 					continue loop
 				}
-				spec.Q, s = expectQuality(s[2:])
-				if spec.Q < 0.0 {
+				pvalue, s = expectTokenOrQuoted(s[1:])
+				if pvalue == "" {
 					continue loop
 				}
+				s = skipSpace(s)
 			}
 			specs = append(specs, spec)
 			s = skipSpace(s)
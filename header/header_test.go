@@ -129,6 +129,8 @@ var parseAcceptTests = []struct {
 	{"da, en-gb;q=0.8, en;q=0.7", []AcceptSpec{{"da", 1}, {"en-gb", 0.8}, {"en", 0.7}}},
 	{"da, q, en-gb;q=0.8", []AcceptSpec{{"da", 1}, {"q", 1}, {"en-gb", 0.8}}},
 	{"image/png, image/*;q=0.5", []AcceptSpec{{"image/png", 1}, {"image/*", 0.5}}},
+	{"application/vnd.example+json; version=2, text/plain;q=0.5", []AcceptSpec{{"application/vnd.example+json", 1}, {"text/plain", 0.5}}},
+	{`text/html; level="1"; q=0.5`, []AcceptSpec{{"text/html", 0.5}}},
 
 	// bad cases
 	{"value1; q=0.1.2", []AcceptSpec{{"value1", 0.1}}},
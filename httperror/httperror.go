@@ -1,6 +1,7 @@
 package httperror
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 )
@@ -18,20 +19,46 @@ func (err *Error) Error() string {
 	return fmt.Sprintf("status %d", err.Status)
 }
 
-// Convert converts any error to a *Error.
+// Unwrap returns the reason for the HTTP error.
+func (err *Error) Unwrap() error { return err.Err }
+
+// Convert converts any error to a *Error. Convert finds an *Error or
+// *Problem in the error chain with errors.As. If err wraps an *Error, then
+// Convert returns an *Error with the status and message of the wrapped
+// *Error and with err as the reason so that the full chain is kept. A
+// *Problem is converted to an *Error with the problem status and title. Other errors are converted to an
+// *Error with the status registered for the error (see Register) or status
+// 500. The message is the status text so that internal error messages are
+// not shown to the user.
 func Convert(err error) *Error {
 	if err == nil {
 		return nil
 	}
-	status := http.StatusInternalServerError
-	message := "Internal Server Error"
-	if e, ok := err.(*Error); ok {
-		if e.Message != "" {
-			return e
+	var e *Error
+	if errors.As(err, &e) {
+		message := e.Message
+		if message == "" {
+			message = http.StatusText(e.Status)
+		}
+		if e == err {
+			if e.Message != "" {
+				return e
+			}
+			return &Error{Status: e.Status, Message: message, Err: e.Err}
+		}
+		return &Error{Status: e.Status, Message: message, Err: err}
+	}
+	status := statusForError(err)
+	message := http.StatusText(status)
+	var p *Problem
+	if errors.As(err, &p) {
+		if p.Status != 0 {
+			status = p.Status
+		}
+		message = p.Title
+		if message == "" {
+			message = http.StatusText(status)
 		}
-		status = e.Status
-		err = e.Err
-		message = http.StatusText(status)
 	}
 	return &Error{
 		Status:  status,
@@ -45,8 +72,10 @@ func standardError(status int) *Error {
 }
 
 var (
-	ErrBadRequest       = standardError(http.StatusBadRequest)
-	ErrForbidden        = standardError(http.StatusForbidden)
-	ErrMethodNotAllowed = standardError(http.StatusMethodNotAllowed)
-	ErrNotFound         = standardError(http.StatusNotFound)
+	ErrBadRequest            = standardError(http.StatusBadRequest)
+	ErrForbidden             = standardError(http.StatusForbidden)
+	ErrMethodNotAllowed      = standardError(http.StatusMethodNotAllowed)
+	ErrNotFound              = standardError(http.StatusNotFound)
+	ErrRequestEntityTooLarge = standardError(http.StatusRequestEntityTooLarge)
+	ErrServiceUnavailable    = standardError(http.StatusServiceUnavailable)
 )
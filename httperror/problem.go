@@ -0,0 +1,336 @@
+package httperror
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Problem is a problem details document as specified in RFC 9457. A handler
+// can return a *Problem as an error to send problem details to the client.
+type Problem struct {
+	// Type is a URI reference that identifies the problem type. An empty
+	// string is equivalent to "about:blank".
+	Type string
+
+	// Title is a short, human-readable summary of the problem type.
+	Title string
+
+	// Status is the HTTP status code.
+	Status int
+
+	// Detail is a human-readable explanation specific to this occurrence of
+	// the problem.
+	Detail string
+
+	// Instance is a URI reference that identifies this occurrence of the
+	// problem.
+	Instance string
+
+	// Extensions are additional members of the problem document. The values
+	// must be encodable with encoding/json.
+	Extensions map[string]interface{}
+}
+
+func (p *Problem) Error() string {
+	s := fmt.Sprintf("status %d, %s", p.Status, p.Title)
+	if p.Detail != "" {
+		s += ": " + p.Detail
+	}
+	return s
+}
+
+// NewProblem converts any error to a problem document. The error is converted
+// with Convert. If the converted error wraps a *Problem, then a copy of the
+// problem is returned. Otherwise, the problem has the status and user visible
+// message from the converted error. Internal error messages are not included
+// in the problem.
+func NewProblem(err error) *Problem {
+	e := Convert(err)
+	if e == nil {
+		return nil
+	}
+	var p *Problem
+	if errors.As(e.Err, &p) {
+		q := *p
+		q.Status = e.Status
+		if q.Title == "" {
+			q.Title = e.Message
+		}
+		return &q
+	}
+	return &Problem{Title: e.Message, Status: e.Status}
+}
+
+var problemMembers = []string{"type", "title", "status", "detail", "instance"}
+
+func isProblemMember(name string) bool {
+	for _, m := range problemMembers {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON encodes the problem in the application/problem+json format.
+// Extensions with the name of a standard member are ignored.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		if !isProblemMember(k) {
+			m[k] = v
+		}
+	}
+	if p.Type != "" {
+		m["type"] = p.Type
+	}
+	if p.Title != "" {
+		m["title"] = p.Title
+	}
+	if p.Status != 0 {
+		m["status"] = p.Status
+	}
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON decodes a problem in the application/problem+json format.
+// Standard members with the wrong type are ignored as required by the RFC.
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*p = Problem{}
+	for k, raw := range m {
+		switch k {
+		case "type":
+			json.Unmarshal(raw, &p.Type)
+		case "title":
+			json.Unmarshal(raw, &p.Title)
+		case "status":
+			json.Unmarshal(raw, &p.Status)
+		case "detail":
+			json.Unmarshal(raw, &p.Detail)
+		case "instance":
+			json.Unmarshal(raw, &p.Instance)
+		default:
+			var v interface{}
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return err
+			}
+			if p.Extensions == nil {
+				p.Extensions = make(map[string]interface{})
+			}
+			p.Extensions[k] = v
+		}
+	}
+	return nil
+}
+
+// problemNamespace is the XML namespace for problem documents.
+const problemNamespace = "urn:ietf:rfc:7807"
+
+// MarshalXML encodes the problem in the application/problem+xml format.
+// Extension values are converted to the JSON data model. Arrays are encoded as
+// a sequence of i elements and objects are encoded as child elements.
+func (p *Problem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Local: "problem"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: problemNamespace}}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, f := range []struct{ name, value string }{
+		{"type", p.Type},
+		{"title", p.Title},
+		{"status", strconv.Itoa(p.Status)},
+		{"detail", p.Detail},
+		{"instance", p.Instance},
+	} {
+		if f.value == "" || f.name == "status" && p.Status == 0 {
+			continue
+		}
+		if err := e.EncodeElement(f.value, xml.StartElement{Name: xml.Name{Local: f.name}}); err != nil {
+			return err
+		}
+	}
+	keys := make([]string, 0, len(p.Extensions))
+	for k := range p.Extensions {
+		if !isProblemMember(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// Convert the value to the JSON data model.
+		data, err := json.Marshal(p.Extensions[k])
+		if err != nil {
+			return err
+		}
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		if err := encodeXMLValue(e, k, v); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeToken(start.End()); err != nil {
+		return err
+	}
+	return e.Flush()
+}
+
+func encodeXMLValue(e *xml.Encoder, name string, v interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case nil:
+	case []interface{}:
+		for _, x := range v {
+			if err := encodeXMLValue(e, "i", x); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := encodeXMLValue(e, k, v[k]); err != nil {
+				return err
+			}
+		}
+	case float64:
+		if err := e.EncodeToken(xml.CharData(strconv.FormatFloat(v, 'g', -1, 64))); err != nil {
+			return err
+		}
+	default:
+		if err := e.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// xmlNode is a generic XML element.
+type xmlNode struct {
+	XMLName xml.Name
+	Text    string    `xml:",chardata"`
+	Nodes   []xmlNode `xml:",any"`
+}
+
+// value returns the value of the node. Elements with only i child elements
+// are arrays and other elements with child elements are objects. The values
+// of elements without child elements are strings.
+func (n *xmlNode) value() interface{} {
+	if len(n.Nodes) == 0 {
+		return strings.TrimSpace(n.Text)
+	}
+	isArray := true
+	for _, c := range n.Nodes {
+		if c.XMLName.Local != "i" {
+			isArray = false
+			break
+		}
+	}
+	if isArray {
+		a := make([]interface{}, len(n.Nodes))
+		for i := range n.Nodes {
+			a[i] = n.Nodes[i].value()
+		}
+		return a
+	}
+	m := make(map[string]interface{}, len(n.Nodes))
+	for i := range n.Nodes {
+		m[n.Nodes[i].XMLName.Local] = n.Nodes[i].value()
+	}
+	return m
+}
+
+// UnmarshalXML decodes a problem in the application/problem+xml format.
+// Extension values are decoded as strings, []interface{} and
+// map[string]interface{}.
+func (p *Problem) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var n xmlNode
+	if err := d.DecodeElement(&n, &start); err != nil {
+		return err
+	}
+	*p = Problem{}
+	for i := range n.Nodes {
+		c := &n.Nodes[i]
+		text := strings.TrimSpace(c.Text)
+		switch c.XMLName.Local {
+		case "type":
+			p.Type = text
+		case "title":
+			p.Title = text
+		case "status":
+			p.Status, _ = strconv.Atoi(text)
+		case "detail":
+			p.Detail = text
+		case "instance":
+			p.Instance = text
+		default:
+			if p.Extensions == nil {
+				p.Extensions = make(map[string]interface{})
+			}
+			p.Extensions[c.XMLName.Local] = c.value()
+		}
+	}
+	return nil
+}
+
+// maxProblemSize is the maximum size of a problem document read by
+// ParseProblem.
+const maxProblemSize = 1 << 20
+
+// ParseProblem reads a problem document from a client response with the
+// application/problem+json or application/problem+xml content type. If the
+// response has another content type, then ParseProblem returns a problem
+// with the response status code and the status text as the title. The caller
+// is responsible for closing the response body.
+func ParseProblem(resp *http.Response) (*Problem, error) {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	var unmarshal func([]byte, interface{}) error
+	switch mediaType {
+	case "application/problem+json":
+		unmarshal = json.Unmarshal
+	case "application/problem+xml":
+		unmarshal = xml.Unmarshal
+	default:
+		return &Problem{Status: resp.StatusCode, Title: http.StatusText(resp.StatusCode)}, nil
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxProblemSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxProblemSize {
+		return nil, errors.New("httperror: problem document too large")
+	}
+	var p Problem
+	if err := unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	if p.Status == 0 {
+		p.Status = resp.StatusCode
+	}
+	return &p, nil
+}
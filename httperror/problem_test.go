@@ -0,0 +1,127 @@
+package httperror
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var errSecret = errors.New("secret")
+
+var testProblem = &Problem{
+	Type:     "https://example.com/probs/out-of-credit",
+	Title:    "You do not have enough credit.",
+	Status:   403,
+	Detail:   "Your current balance is 30, but that costs 50.",
+	Instance: "/account/12345/msgs/abc",
+	Extensions: map[string]interface{}{
+		"balance":  30,
+		"accounts": []string{"/account/12345", "/account/67890"},
+	},
+}
+
+func writeProblem(accept string, err error) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	Write(w, r, err)
+	return w
+}
+
+func TestProblemJSON(t *testing.T) {
+	for _, accept := range []string{
+		"application/problem+json",
+		"application/json",
+		"application/json, application/problem+json",
+		"application/*",
+	} {
+		w := writeProblem(accept, testProblem)
+		if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("accept=%q: content type %q, want application/problem+json", accept, ct)
+		}
+		if w.Code != 403 {
+			t.Errorf("accept=%q: status %d, want 403", accept, w.Code)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+			t.Fatalf("accept=%q: %v", accept, err)
+		}
+		want := map[string]interface{}{
+			"type":     "https://example.com/probs/out-of-credit",
+			"title":    "You do not have enough credit.",
+			"status":   403.0,
+			"detail":   "Your current balance is 30, but that costs 50.",
+			"instance": "/account/12345/msgs/abc",
+			"balance":  30.0,
+			"accounts": []interface{}{"/account/12345", "/account/67890"},
+		}
+		if !reflect.DeepEqual(m, want) {
+			t.Errorf("accept=%q: body %v, want %v", accept, m, want)
+		}
+	}
+}
+
+func TestProblemXML(t *testing.T) {
+	w := writeProblem("application/problem+xml", testProblem)
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+xml" {
+		t.Errorf("content type %q, want application/problem+xml", ct)
+	}
+	body := w.Body.String()
+	for _, s := range []string{
+		`<problem xmlns="urn:ietf:rfc:7807">`,
+		`<status>403</status>`,
+		`<accounts><i>/account/12345</i><i>/account/67890</i></accounts>`,
+		`<balance>30</balance>`,
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("body %s does not contain %s", body, s)
+		}
+	}
+	var p Problem
+	if err := xml.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != testProblem.Type || p.Title != testProblem.Title || p.Status != 403 ||
+		p.Detail != testProblem.Detail || p.Instance != testProblem.Instance ||
+		p.Extensions["balance"] != "30" || len(p.Extensions["accounts"].([]interface{})) != 2 {
+		t.Errorf("xml.Unmarshal() = %+v", p)
+	}
+}
+
+func TestParseProblem(t *testing.T) {
+	for _, accept := range []string{"application/problem+json", "application/problem+xml"} {
+		w := writeProblem(accept, testProblem)
+		p, err := ParseProblem(w.Result())
+		if err != nil {
+			t.Fatalf("accept=%q: %v", accept, err)
+		}
+		if p.Type != testProblem.Type || p.Status != 403 || p.Detail != testProblem.Detail || p.Extensions["balance"] == nil {
+			t.Errorf("accept=%q: ParseProblem() = %+v", accept, p)
+		}
+	}
+
+	w := writeProblem("text/plain", ErrNotFound)
+	p, err := ParseProblem(w.Result())
+	if err != nil || p.Status != 404 || p.Title != "Not Found" {
+		t.Errorf("ParseProblem(text/plain) = %+v, %v", p, err)
+	}
+}
+
+func TestNewProblem(t *testing.T) {
+	p := NewProblem(&Error{Status: 400, Err: testProblem})
+	if p.Status != 400 || p.Detail != testProblem.Detail {
+		t.Errorf("NewProblem(*Error with *Problem) = %+v", p)
+	}
+	p = NewProblem(&Error{Status: 502, Err: errSecret})
+	if !reflect.DeepEqual(p, &Problem{Title: "Bad Gateway", Status: 502}) {
+		t.Errorf("NewProblem(*Error) = %+v", p)
+	}
+	if NewProblem(nil) != nil {
+		t.Error("NewProblem(nil) != nil")
+	}
+}
@@ -0,0 +1,78 @@
+package httperror
+
+import (
+	"database/sql"
+	"errors"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+type statusEntry struct {
+	match  func(err error) bool
+	status int
+}
+
+var registry struct {
+	mu      sync.RWMutex
+	entries []statusEntry
+}
+
+// Register specifies the HTTP status for errors that match target as
+// determined by errors.Is. Convert uses the status for errors that are not
+// an *Error or *Problem. Registrations made later take precedence over
+// earlier registrations for the same error and the default registrations:
+//
+//	sql.ErrNoRows             404
+//	fs.ErrNotExist            404
+//	fs.ErrPermission          403
+//	context.DeadlineExceeded  504
+//	*http.MaxBytesError       413
+//
+// Register panics if target is nil or status is not a client or server error
+// status.
+func Register(target error, status int) {
+	if target == nil {
+		panic("httperror: nil target")
+	}
+	RegisterFunc(func(err error) bool { return errors.Is(err, target) }, status)
+}
+
+// RegisterFunc specifies the HTTP status for errors where match returns true.
+// Use RegisterFunc to match error types with errors.As. RegisterFunc panics
+// if status is not a client or server error status.
+func RegisterFunc(match func(err error) bool, status int) {
+	if status < 400 || status > 599 {
+		panic("httperror: invalid error status " + strconv.Itoa(status))
+	}
+	registry.mu.Lock()
+	registry.entries = append(registry.entries, statusEntry{match, status})
+	registry.mu.Unlock()
+}
+
+// statusForError returns the registered status for err or 500 if there is no
+// registered status.
+func statusForError(err error) int {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	for i := len(registry.entries) - 1; i >= 0; i-- {
+		if e := registry.entries[i]; e.match(err) {
+			return e.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+func init() {
+	Register(sql.ErrNoRows, http.StatusNotFound)
+	Register(fs.ErrNotExist, http.StatusNotFound)
+	Register(fs.ErrPermission, http.StatusForbidden)
+	Register(context.DeadlineExceeded, http.StatusGatewayTimeout)
+	RegisterFunc(func(err error) bool {
+		var e *http.MaxBytesError
+		return errors.As(err, &e)
+	}, http.StatusRequestEntityTooLarge)
+}
@@ -0,0 +1,145 @@
+package httperror
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+var (
+	errConflict = errors.New("conflict")
+	errTeapot   = errors.New("teapot")
+	errUnknown  = errors.New("unknown")
+)
+
+// withRegistry runs fn and restores the registry.
+func withRegistry(fn func()) {
+	registry.mu.Lock()
+	saved := append([]statusEntry(nil), registry.entries...)
+	registry.mu.Unlock()
+	defer func() {
+		registry.mu.Lock()
+		registry.entries = saved
+		registry.mu.Unlock()
+	}()
+	fn()
+}
+
+var convertTests = []struct {
+	err     error
+	status  int
+	message string
+}{
+	{ErrNotFound, 404, "Not Found"},
+	{fmt.Errorf("load: %w", ErrNotFound), 404, "Not Found"},
+	{fmt.Errorf("load: %w", &Error{Status: 400, Message: "Bad name"}), 400, "Bad name"},
+	{fmt.Errorf("load: %w", &Error{Status: 409, Err: errUnknown}), 409, "Conflict"},
+	{fmt.Errorf("load: %w", &Problem{Status: 422, Title: "Invalid"}), 422, "Invalid"},
+	{sql.ErrNoRows, 404, "Not Found"},
+	{fmt.Errorf("query: %w", sql.ErrNoRows), 404, "Not Found"},
+	{&os.PathError{Op: "open", Path: "x", Err: os.ErrNotExist}, 404, "Not Found"},
+	{&os.PathError{Op: "open", Path: "x", Err: os.ErrPermission}, 403, "Forbidden"},
+	{fmt.Errorf("fetch: %w", context.DeadlineExceeded), 504, "Gateway Timeout"},
+	{fmt.Errorf("read: %w", &http.MaxBytesError{Limit: 10}), 413, "Request Entity Too Large"},
+	{errUnknown, 500, "Internal Server Error"},
+	{errConflict, 409, "Conflict"},
+	{fmt.Errorf("save: %w", errConflict), 409, "Conflict"},
+	{errTeapot, 418, "I'm a teapot"},
+}
+
+func TestConvert(t *testing.T) {
+	withRegistry(func() {
+		Register(errConflict, http.StatusConflict)
+		// The later registration for the same error takes precedence.
+		Register(errTeapot, http.StatusBadRequest)
+		Register(errTeapot, http.StatusTeapot)
+		for _, tt := range convertTests {
+			e := Convert(tt.err)
+			if e.Status != tt.status || e.Message != tt.message {
+				t.Errorf("Convert(%v) = %d %q, want %d %q", tt.err, e.Status, e.Message, tt.status, tt.message)
+			}
+		}
+	})
+	if e := Convert(errConflict); e.Status != 500 {
+		t.Errorf("Convert(errConflict) after restoring registry = %d, want 500", e.Status)
+	}
+	if Convert(nil) != nil {
+		t.Error("Convert(nil) != nil")
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	err := &Error{Status: 404, Err: sql.ErrNoRows}
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Error("errors.Is(*Error, sql.ErrNoRows) = false")
+	}
+	if !errors.Is(fmt.Errorf("x: %w", ErrForbidden), ErrForbidden) {
+		t.Error("errors.Is(wrapped ErrForbidden, ErrForbidden) = false")
+	}
+}
+
+func TestConvertKeepsChain(t *testing.T) {
+	reason := errors.New("token does not match")
+	err := fmt.Errorf("%w: %w", ErrForbidden, reason)
+	e := Convert(err)
+	if e.Status != http.StatusForbidden || e.Message != ErrForbidden.Message {
+		t.Errorf("Convert() = %d %q, want %d %q", e.Status, e.Message, http.StatusForbidden, ErrForbidden.Message)
+	}
+	if e == ErrForbidden || ErrForbidden.Err != nil {
+		t.Error("Convert() returned or modified the shared ErrForbidden")
+	}
+	if !errors.Is(e.Err, reason) || !errors.Is(e, ErrForbidden) {
+		t.Errorf("Convert().Err = %v, want chain with reason and ErrForbidden", e.Err)
+	}
+
+	// An *Error is returned as is.
+	if e := Convert(ErrNotFound); e != ErrNotFound {
+		t.Errorf("Convert(ErrNotFound) = %v, want ErrNotFound", e)
+	}
+}
+
+func TestInvalidRegister(t *testing.T) {
+	for _, fn := range []func(){
+		func() { Register(nil, 404) },
+		func() { Register(errUnknown, 200) },
+		func() { Register(errUnknown, 600) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("Register did not panic")
+				}
+			}()
+			withRegistry(fn)
+		}()
+	}
+}
+
+var errorFnWrapTests = []struct {
+	status int
+	err    error
+	want   int
+}{
+	{500, fmt.Errorf("handler: %w", ErrNotFound), 404},
+	{500, fmt.Errorf("handler: %w", &Problem{Status: 422, Title: "Invalid"}), 422},
+	{500, fmt.Errorf("handler: %w", sql.ErrNoRows), 404},
+	{503, fmt.Errorf("handler: %w", sql.ErrNoRows), 503},
+	{500, errUnknown, 500},
+}
+
+func TestErrorFnWrapped(t *testing.T) {
+	for _, tt := range errorFnWrapTests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		DefaultWriter.ErrorFn(context.Background(), w, r, tt.status, tt.err)
+		if w.Code != tt.want {
+			t.Errorf("ErrorFn(%d, %v) status = %d, want %d", tt.status, tt.err, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package httperror
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+
+	"github.com/garyburd/web/header"
+	"github.com/garyburd/web/templates"
+	"golang.org/x/net/context"
+)
+
+// Writer writes error responses in the format requested by the client.
+type Writer struct {
+	// HTML maps status codes to templates for HTML responses. The template
+	// for status 0 is used when there is no template for the status. If
+	// there is no template, then a built-in page is used. The templates are
+	// executed with the *Error as data.
+	HTML map[int]*templates.Template
+}
+
+// DefaultWriter is the Writer used by Write.
+var DefaultWriter = &Writer{}
+
+// Write writes an error response for err using DefaultWriter.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	DefaultWriter.Write(w, r, err)
+}
+
+// offers are the negotiated content types. Plain text is first so that
+// clients accepting */* get plain text.
+var offers = []string{
+	"text/plain",
+	"text/html",
+	"application/problem+json",
+	"application/json",
+	"application/problem+xml",
+	"application/xml",
+}
+
+var defaultTemplate = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html><head><title>{{.Status}} {{.Message}}</title></head>
+<body><h1>{{.Status}} {{.Message}}</h1></body></html>
+`))
+
+// Write converts err to an *Error with Convert and writes the error response.
+// The response is HTML, a problem details document in JSON or XML (see
+// NewProblem) or plain text as negotiated from the request Accept header.
+// Write writes plain text if the request does not have an Accept header,
+// accepts any type or does not accept the other formats.
+func (ew *Writer) Write(w http.ResponseWriter, r *http.Request, err error) {
+	e := Convert(err)
+	if e == nil {
+		e = standardError(http.StatusInternalServerError)
+	}
+	h := w.Header()
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Cache-Control", "no-store")
+
+	switch header.NegotiateContentType(r, offers, "text/plain") {
+	case "text/html":
+		t := ew.HTML[e.Status]
+		if t == nil {
+			t = ew.HTML[0]
+		}
+		if t != nil {
+			if err := t.WriteResponse(w, r, e.Status, e); err == nil {
+				return
+			}
+		} else {
+			var buf bytes.Buffer
+			if err := defaultTemplate.Execute(&buf, e); err == nil {
+				h.Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(e.Status)
+				w.Write(buf.Bytes())
+				return
+			}
+		}
+	case "application/problem+json", "application/json":
+		p, err := json.Marshal(NewProblem(e))
+		if err == nil {
+			h.Set("Content-Type", "application/problem+json")
+			w.WriteHeader(e.Status)
+			w.Write(p)
+			return
+		}
+	case "application/problem+xml", "application/xml":
+		p, err := xml.Marshal(NewProblem(e))
+		if err == nil {
+			h.Set("Content-Type", "application/problem+xml")
+			w.WriteHeader(e.Status)
+			io.WriteString(w, xml.Header)
+			w.Write(p)
+			return
+		}
+	}
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(e.Status)
+	w.Write([]byte(e.Message + "\n"))
+}
+
+// ErrorFn writes an error response for the status and error. The signature
+// matches router.ErrorFn so that the method can be installed directly:
+//
+//	r.ErrorFn(w.ErrorFn)
+//
+// If err is nil, then the response has the given status. If err wraps an
+// *Error or *Problem, then the response has the status from the wrapped
+// error. If status is 500, then other errors are converted with Convert so
+// that registered statuses apply. Otherwise, the response has the given
+// status.
+func (ew *Writer) ErrorFn(ctx context.Context, w http.ResponseWriter, r *http.Request, status int, err error) {
+	var e *Error
+	var p *Problem
+	switch {
+	case err == nil:
+		err = standardError(status)
+	case errors.As(err, &e) || errors.As(err, &p):
+	case status != http.StatusInternalServerError:
+		err = &Error{Status: status, Err: err}
+	}
+	ew.Write(w, r, err)
+}
@@ -0,0 +1,120 @@
+package httperror
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/garyburd/web/templates"
+	"golang.org/x/net/context"
+)
+
+var writeTests = []struct {
+	accept      string
+	err         error
+	status      int
+	contentType string
+	body        string
+}{
+	{"", ErrNotFound, 404, "text/plain; charset=utf-8", "Not Found\n"},
+	{"*/*", ErrNotFound, 404, "text/plain; charset=utf-8", "Not Found\n"},
+	{"image/png", ErrNotFound, 404, "text/plain; charset=utf-8", "Not Found\n"},
+	{"text/plain", &Error{Status: 409, Message: "Try again"}, 409, "text/plain; charset=utf-8", "Try again\n"},
+	{"text/html,application/xhtml+xml,*/*;q=0.8", ErrForbidden, 403, "text/html; charset=utf-8", "<h1>403 Forbidden</h1>"},
+	{"application/json", ErrNotFound, 404, "application/problem+json", `{"status":404,"title":"Not Found"}`},
+	{"application/json", errors.New("secret"), 500, "application/problem+json", `{"status":500,"title":"Internal Server Error"}`},
+	{"text/plain", errors.New("secret"), 500, "text/plain; charset=utf-8", "Internal Server Error\n"},
+	{"text/html", errors.New("secret"), 500, "text/html; charset=utf-8", "<h1>500 Internal Server Error</h1>"},
+	{"text/plain", &Error{Status: 400, Err: errors.New("secret")}, 400, "text/plain; charset=utf-8", "Bad Request\n"},
+}
+
+func TestWrite(t *testing.T) {
+	for _, tt := range writeTests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		Write(w, r, tt.err)
+		if w.Code != tt.status {
+			t.Errorf("accept=%q, err=%v: status %d, want %d", tt.accept, tt.err, w.Code, tt.status)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("accept=%q, err=%v: content type %q, want %q", tt.accept, tt.err, ct, tt.contentType)
+		}
+		if body := w.Body.String(); !strings.Contains(body, tt.body) {
+			t.Errorf("accept=%q, err=%v: body %q, want %q", tt.accept, tt.err, body, tt.body)
+		}
+		if strings.Contains(w.Body.String(), "secret") {
+			t.Errorf("accept=%q, err=%v: body %q has internal message", tt.accept, tt.err, w.Body.String())
+		}
+	}
+}
+
+var errorFnTests = []struct {
+	status int
+	err    error
+	want   int
+	body   string
+}{
+	{404, nil, 404, "Not Found\n"},
+	{500, errors.New("secret"), 500, "Internal Server Error\n"},
+	{503, errors.New("secret"), 503, "Service Unavailable\n"},
+	{500, &Error{Status: 429, Message: "Slow down"}, 429, "Slow down\n"},
+}
+
+func TestErrorFn(t *testing.T) {
+	for _, tt := range errorFnTests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		DefaultWriter.ErrorFn(context.Background(), w, r, tt.status, tt.err)
+		if w.Code != tt.want || w.Body.String() != tt.body {
+			t.Errorf("ErrorFn(%d, %v) = %d %q, want %d %q", tt.status, tt.err, w.Code, w.Body.String(), tt.want, tt.body)
+		}
+	}
+}
+
+func TestWriteTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httperror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, text := range map[string]string{
+		"404.html":   `{{define "ROOT"}}missing {{.Status}}{{end}}`,
+		"error.html": `{{define "ROOT"}}error {{.Status}} {{.Message}}{{end}}`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var m templates.Manager
+	ew := &Writer{HTML: map[int]*templates.Template{
+		404: m.NewHTML("404.html"),
+		0:   m.NewHTML("error.html"),
+	}}
+	if err := m.Load(dir, true); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		err  error
+		body string
+	}{
+		{ErrNotFound, "missing 404"},
+		{ErrForbidden, "error 403 Forbidden"},
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+		ew.Write(w, r, tt.err)
+		if w.Body.String() != tt.body || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+			t.Errorf("Write(%v) = %q %q, want %q", tt.err, w.Header().Get("Content-Type"), w.Body.String(), tt.body)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sqltest implements an in-memory database/sql driver for testing
+// the SQL stores in this module.
+//
+// The driver supports the statements used by the stores:
+//
+//	SELECT c1, c2 FROM t WHERE conditions
+//	INSERT INTO t (c1, c2) VALUES (?, ?)
+//	UPDATE t SET c1 = ?, c2 = ? WHERE conditions
+//	DELETE FROM t WHERE conditions
+//
+// Conditions are "c = ?" or "c <= ?" joined by AND. Placeholders are "?" or
+// "$n". Transactions are not isolated and rollback is not supported.
+package sqltest // import "github.com/garyburd/web/internal/sqltest"
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+func init() {
+	sql.Register("sqltest", &fakeDriver{dbs: make(map[string]*database)})
+}
+
+var (
+	nextMu sync.Mutex
+	next   int
+)
+
+// Open returns a new empty database.
+func Open() *sql.DB {
+	nextMu.Lock()
+	next++
+	name := strconv.Itoa(next)
+	nextMu.Unlock()
+	db, err := sql.Open("sqltest", name)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+type fakeDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*database
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	db := d.dbs[name]
+	if db == nil {
+		db = &database{tables: make(map[string][]row)}
+		d.dbs[name] = db
+	}
+	return &conn{db: db}, nil
+}
+
+type row map[string]driver.Value
+
+type database struct {
+	mu     sync.Mutex
+	tables map[string][]row
+}
+
+type conn struct {
+	db *database
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{db: c.db, query: query}, nil
+}
+
+func (c *conn) Close() error { return nil }
+
+func (c *conn) Begin() (driver.Tx, error) { return tx{}, nil }
+
+type tx struct{}
+
+func (tx) Commit() error   { return nil }
+func (tx) Rollback() error { return errors.New("sqltest: rollback not supported") }
+
+type stmt struct {
+	db    *database
+	query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+var placeholderPattern = regexp.MustCompile(`\?|\$[0-9]+`)
+
+// bind replaces the placeholders in the query with indexes into args.
+func bind(query string, args []driver.Value) (string, []driver.Value, error) {
+	i := 0
+	var err error
+	query = placeholderPattern.ReplaceAllStringFunc(query, func(p string) string {
+		n := i
+		if p != "?" {
+			n, _ = strconv.Atoi(p[1:])
+			n--
+		}
+		i++
+		if n < 0 || n >= len(args) {
+			err = errors.New("sqltest: bad placeholder " + p)
+		}
+		return "#" + strconv.Itoa(n)
+	})
+	return query, args, err
+}
+
+type condition struct {
+	column string
+	op     string
+	arg    int
+}
+
+var conditionPattern = regexp.MustCompile(`^(\w+) (=|<=) #([0-9]+)$`)
+
+func parseConditions(s string) ([]condition, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var conds []condition
+	for _, part := range strings.Split(s, " AND ") {
+		m := conditionPattern.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, errors.New("sqltest: unsupported condition " + part)
+		}
+		arg, _ := strconv.Atoi(m[3])
+		conds = append(conds, condition{m[1], m[2], arg})
+	}
+	return conds, nil
+}
+
+func match(r row, conds []condition, args []driver.Value) bool {
+	for _, c := range conds {
+		v, a := r[c.column], args[c.arg]
+		switch c.op {
+		case "=":
+			if !equal(v, a) {
+				return false
+			}
+		case "<=":
+			x, ok1 := v.(int64)
+			y, ok2 := a.(int64)
+			if !ok1 || !ok2 || x > y {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func equal(a, b driver.Value) bool {
+	switch a := a.(type) {
+	case []byte:
+		b, ok := b.([]byte)
+		return ok && bytes.Equal(a, b)
+	default:
+		return a == b
+	}
+}
+
+// clone copies byte slices so that the database does not share memory with
+// the caller.
+func clone(v driver.Value) driver.Value {
+	if p, ok := v.([]byte); ok {
+		return append([]byte(nil), p...)
+	}
+	return v
+}
+
+func columns(s string) []string {
+	var cols []string
+	for _, c := range strings.Split(s, ",") {
+		cols = append(cols, strings.TrimSpace(c))
+	}
+	return cols
+}
+
+var (
+	selectPattern = regexp.MustCompile(`^SELECT (.+) FROM (\w+)(?: WHERE (.+))?$`)
+	insertPattern = regexp.MustCompile(`^INSERT INTO (\w+) \((.+)\) VALUES \((.+)\)$`)
+	updatePattern = regexp.MustCompile(`^UPDATE (\w+) SET (.+) WHERE (.+)$`)
+	deletePattern = regexp.MustCompile(`^DELETE FROM (\w+)(?: WHERE (.+))?$`)
+)
+
+type result int64
+
+func (r result) LastInsertId() (int64, error) { return 0, errors.New("sqltest: no insert ID") }
+func (r result) RowsAffected() (int64, error) { return int64(r), nil }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	query, args, err := bind(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	switch {
+	case insertPattern.MatchString(query):
+		m := insertPattern.FindStringSubmatch(query)
+		cols, vals := columns(m[2]), columns(m[3])
+		if len(cols) != len(vals) {
+			return nil, errors.New("sqltest: column and value count mismatch")
+		}
+		r := make(row)
+		for i, c := range cols {
+			n, err := strconv.Atoi(strings.TrimPrefix(vals[i], "#"))
+			if err != nil {
+				return nil, errors.New("sqltest: unsupported value " + vals[i])
+			}
+			r[c] = clone(args[n])
+		}
+		// The first column is the primary key.
+		for _, old := range s.db.tables[m[1]] {
+			if equal(old[cols[0]], r[cols[0]]) {
+				return nil, errors.New("sqltest: duplicate key")
+			}
+		}
+		s.db.tables[m[1]] = append(s.db.tables[m[1]], r)
+		return result(1), nil
+	case updatePattern.MatchString(query):
+		m := updatePattern.FindStringSubmatch(query)
+		set, err := parseConditions(strings.Replace(m[2], ", ", " AND ", -1))
+		if err != nil {
+			return nil, err
+		}
+		conds, err := parseConditions(m[3])
+		if err != nil {
+			return nil, err
+		}
+		n := 0
+		for _, r := range s.db.tables[m[1]] {
+			if match(r, conds, args) {
+				for _, c := range set {
+					r[c.column] = clone(args[c.arg])
+				}
+				n++
+			}
+		}
+		return result(n), nil
+	case deletePattern.MatchString(query):
+		m := deletePattern.FindStringSubmatch(query)
+		conds, err := parseConditions(m[2])
+		if err != nil {
+			return nil, err
+		}
+		var keep []row
+		for _, r := range s.db.tables[m[1]] {
+			if !match(r, conds, args) {
+				keep = append(keep, r)
+			}
+		}
+		n := len(s.db.tables[m[1]]) - len(keep)
+		s.db.tables[m[1]] = keep
+		return result(n), nil
+	}
+	return nil, errors.New("sqltest: unsupported statement " + s.query)
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	query, args, err := bind(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	m := selectPattern.FindStringSubmatch(query)
+	if m == nil {
+		return nil, errors.New("sqltest: unsupported query " + s.query)
+	}
+	conds, err := parseConditions(m[3])
+	if err != nil {
+		return nil, err
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	rs := &rows{columns: columns(m[1])}
+	for _, r := range s.db.tables[m[2]] {
+		if match(r, conds, args) {
+			values := make([]driver.Value, len(rs.columns))
+			for i, c := range rs.columns {
+				values[i] = r[c]
+			}
+			rs.values = append(rs.values, values)
+		}
+	}
+	return rs, nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (rs *rows) Columns() []string { return rs.columns }
+func (rs *rows) Close() error      { return nil }
+
+func (rs *rows) Next(dest []driver.Value) error {
+	if len(rs.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, rs.values[0])
+	rs.values = rs.values[1:]
+	return nil
+}
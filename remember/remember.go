@@ -0,0 +1,255 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package remember implements persistent login tokens for "keep me signed in".
+//
+// A token has two parts: a selector that identifies a series of tokens in the
+// store and a random validator. The store has the SHA-256 hash of the
+// validator, not the validator, so that a copy of the store cannot be used to
+// log in. The token is stored in a cookie encoded by a cookie.Codec.
+//
+// The validator is replaced each time the token is used. If a token with the
+// selector and an old validator is presented, then the token was copied and
+// used by another client. The manager deletes the series so that neither
+// client is logged in by the token.
+package remember // import "github.com/garyburd/web/remember"
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/garyburd/web/cookie"
+	"golang.org/x/net/context"
+)
+
+// now is a hook for tests.
+var now = time.Now
+
+var (
+	// ErrNotFound is returned by Store Load when the series is not found or
+	// has expired.
+	ErrNotFound = errors.New("remember: not found")
+
+	// ErrNoToken is returned by Manager Authenticate when the request does
+	// not have a valid token.
+	ErrNoToken = errors.New("remember: no valid token")
+
+	// ErrTheft is returned by Manager Authenticate when the request has a
+	// token with a valid selector and an old validator. The manager deletes
+	// the series.
+	ErrTheft = errors.New("remember: token reused")
+
+	// ErrConflict is returned by Store Save when the series was replaced
+	// after it was loaded.
+	ErrConflict = errors.New("remember: series changed")
+)
+
+// Series is a series of tokens for a user.
+type Series struct {
+	Selector     string    // Identifies the series.
+	UserID       string    // User that logged in.
+	Hash         []byte    // SHA-256 hash of the current validator.
+	PreviousHash []byte    // SHA-256 hash of the previous validator.
+	Rotated      time.Time // Time that the validator was replaced.
+	Expires      time.Time // Time that the series expires.
+}
+
+// Store loads and saves token series.
+type Store interface {
+	// Load returns the series with the given selector. Load returns
+	// ErrNotFound if the series does not exist or has expired.
+	Load(ctx context.Context, selector string) (*Series, error)
+
+	// Save saves the series. If s.PreviousHash is nil, then Save adds a new
+	// series. Otherwise, Save replaces the stored series only if the stored
+	// hash is equal to s.PreviousHash and returns ErrConflict if it is not.
+	// The check and the replacement must be atomic so that one of two
+	// concurrent rotations fails.
+	Save(ctx context.Context, s *Series) error
+
+	// Delete deletes the series with the given selector. Delete does not
+	// return an error if the series does not exist.
+	Delete(ctx context.Context, selector string) error
+
+	// DeleteUser deletes all series for the user.
+	DeleteUser(ctx context.Context, userID string) error
+}
+
+// Manager issues and checks tokens.
+type Manager struct {
+	codec       *cookie.Codec
+	store       Store
+	lifetime    time.Duration
+	gracePeriod time.Duration
+	theftFn     func(ctx context.Context, r *http.Request, userID string)
+}
+
+// Option specifies an option for a manager.
+type Option struct {
+	f func(*Manager)
+}
+
+// NewManager returns a new manager that stores tokens using codec and the
+// series in store. Configure the codec with HMAC or encryption keys and a
+// maximum age equal to the lifetime. The default lifetime is 30 days and the
+// default grace period is 30 seconds.
+func NewManager(codec *cookie.Codec, store Store, options ...Option) *Manager {
+	m := &Manager{
+		codec:       codec,
+		store:       store,
+		lifetime:    30 * 24 * time.Hour,
+		gracePeriod: 30 * time.Second,
+	}
+	for _, option := range options {
+		option.f(m)
+	}
+	if m.lifetime <= 0 || m.gracePeriod < 0 {
+		panic("remember: lifetime must be greater than zero and grace period must not be negative")
+	}
+	return m
+}
+
+// WithLifetime specifies the time that a series expires after the last use.
+func WithLifetime(d time.Duration) Option {
+	return Option{func(m *Manager) { m.lifetime = d }}
+}
+
+// WithGracePeriod specifies the time after the validator is replaced that the
+// previous validator is accepted. The grace period allows concurrent requests
+// from the browser with the previous token.
+func WithGracePeriod(d time.Duration) Option {
+	return Option{func(m *Manager) { m.gracePeriod = d }}
+}
+
+// WithTheftFn specifies a function that is called when a token with an old
+// validator is detected. Use the function to log the event or notify the
+// user.
+func WithTheftFn(f func(ctx context.Context, r *http.Request, userID string)) Option {
+	return Option{func(m *Manager) { m.theftFn = f }}
+}
+
+func randomString(n int) (string, error) {
+	p := make([]byte, n)
+	if _, err := rand.Read(p); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(p), nil
+}
+
+func hashValidator(validator string) []byte {
+	h := sha256.Sum256([]byte(validator))
+	return h[:]
+}
+
+// rotate replaces the validator in the series, saves the series and writes
+// the token cookie. Rotate returns ErrConflict if a concurrent request
+// replaced the validator.
+func (m *Manager) rotate(ctx context.Context, w http.ResponseWriter, s *Series) error {
+	validator, err := randomString(32)
+	if err != nil {
+		return err
+	}
+	t := now()
+	s.PreviousHash = s.Hash
+	s.Hash = hashValidator(validator)
+	s.Rotated = t
+	s.Expires = t.Add(m.lifetime)
+	if err := m.store.Save(ctx, s); err != nil {
+		return err
+	}
+	return m.codec.Encode(w, s.Selector, validator)
+}
+
+// Login starts a new series for the user and writes the token cookie. Call
+// Login after the user logs in with the "keep me signed in" option.
+func (m *Manager) Login(ctx context.Context, w http.ResponseWriter, userID string) error {
+	selector, err := randomString(18)
+	if err != nil {
+		return err
+	}
+	return m.rotate(ctx, w, &Series{Selector: selector, UserID: userID})
+}
+
+// Authenticate checks the token in the request and returns the user ID. On
+// success, Authenticate replaces the validator and writes the new token
+// cookie. Call Authenticate when the request does not have a logged in
+// session and log the user in with the returned ID. Call Authenticate before
+// writing the response body.
+//
+// Authenticate returns ErrNoToken if the request does not have a valid token
+// and ErrTheft if the token has an old validator. Authenticate deletes the
+// token cookie in both cases.
+func (m *Manager) Authenticate(ctx context.Context, w http.ResponseWriter, r *http.Request) (string, error) {
+	var selector, validator string
+	if err := m.codec.Decode(r, &selector, &validator); err != nil || selector == "" {
+		return "", ErrNoToken
+	}
+	h := hashValidator(validator)
+	for {
+		s, err := m.store.Load(ctx, selector)
+		if err == ErrNotFound {
+			return "", m.reject(w, ErrNoToken)
+		} else if err != nil {
+			return "", err
+		}
+		switch {
+		case subtle.ConstantTimeCompare(h, s.Hash) == 1:
+			err := m.rotate(ctx, w, s)
+			if err == ErrConflict {
+				// A concurrent request rotated the validator after the
+				// series was loaded. Check the token against the new
+				// series.
+				continue
+			} else if err != nil {
+				return "", err
+			}
+		case s.PreviousHash != nil && subtle.ConstantTimeCompare(h, s.PreviousHash) == 1 &&
+			now().Before(s.Rotated.Add(m.gracePeriod)):
+			// A concurrent request rotated the validator. The browser
+			// receives the new token from the response to that request.
+		default:
+			// The selector is valid and the validator is not. Another
+			// client used the token.
+			if err := m.store.Delete(ctx, selector); err != nil {
+				return "", err
+			}
+			if m.theftFn != nil {
+				m.theftFn(ctx, r, s.UserID)
+			}
+			return "", m.reject(w, ErrTheft)
+		}
+		return s.UserID, nil
+	}
+}
+
+// reject deletes the token cookie and returns err.
+func (m *Manager) reject(w http.ResponseWriter, err error) error {
+	if cerr := m.codec.Encode(w); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// Logout deletes the series for the token in the request and deletes the
+// token cookie.
+func (m *Manager) Logout(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var selector string
+	if err := m.codec.Decode(r, &selector); err == nil && selector != "" {
+		if err := m.store.Delete(ctx, selector); err != nil {
+			return err
+		}
+	}
+	return m.codec.Encode(w)
+}
+
+// LogoutUser deletes all series for the user. Call LogoutUser when the user
+// changes their password or logs out of all devices.
+func (m *Manager) LogoutUser(ctx context.Context, userID string) error {
+	return m.store.DeleteUser(ctx, userID)
+}
@@ -0,0 +1,218 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package remember
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/garyburd/web/cookie"
+	"golang.org/x/net/context"
+)
+
+// client holds the token cookie between requests.
+type client struct {
+	cookie string
+}
+
+func (c *client) update(w *httptest.ResponseRecorder) {
+	if setCookie := w.Header().Get("Set-Cookie"); setCookie != "" {
+		c.cookie = setCookie[:strings.Index(setCookie, ";")]
+		if strings.Contains(setCookie, "max-age=-") {
+			c.cookie = ""
+		}
+	}
+}
+
+func (c *client) authenticate(m *Manager) (string, error) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	if c.cookie != "" {
+		r.Header.Set("Cookie", c.cookie)
+	}
+	w := httptest.NewRecorder()
+	userID, err := m.Authenticate(context.Background(), w, r)
+	c.update(w)
+	return userID, err
+}
+
+func TestRemember(t *testing.T) {
+	t0 := time.Unix(1136214245, 0)
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	codec := cookie.NewCodec("remember", cookie.WithHMACKeys([][]byte{[]byte("key")}))
+	var stolen []string
+	m := NewManager(codec, store, WithLifetime(time.Hour), WithGracePeriod(time.Minute),
+		WithTheftFn(func(ctx context.Context, r *http.Request, userID string) { stolen = append(stolen, userID) }))
+
+	var c client
+	if _, err := c.authenticate(m); err != ErrNoToken {
+		t.Fatalf("authenticate without token returned %v, want ErrNoToken", err)
+	}
+
+	w := httptest.NewRecorder()
+	if err := m.Login(ctx, w, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	c.update(w)
+
+	// The store does not have the validator.
+	var selector, validator string
+	codec.Decode(&http.Request{Header: http.Header{"Cookie": {c.cookie}}}, &selector, &validator)
+	s, _ := store.Load(ctx, selector)
+	if s == nil || s.UserID != "alice" || strings.Contains(string(s.Hash), validator) {
+		t.Fatalf("store has series %+v", s)
+	}
+
+	// Each use rotates the validator.
+	first := c.cookie
+	t0 = t0.Add(30 * time.Minute)
+	if userID, err := c.authenticate(m); err != nil || userID != "alice" {
+		t.Fatalf("authenticate = %q, %v", userID, err)
+	}
+	if c.cookie == first {
+		t.Fatal("token not rotated")
+	}
+
+	// The previous token is accepted during the grace period.
+	old := client{cookie: first}
+	if userID, err := old.authenticate(m); err != nil || userID != "alice" {
+		t.Errorf("authenticate(previous token in grace period) = %q, %v", userID, err)
+	}
+
+	// The series expires after the lifetime from the last use.
+	t0 = t0.Add(50 * time.Minute)
+	if userID, err := c.authenticate(m); err != nil || userID != "alice" {
+		t.Fatalf("authenticate after rotation = %q, %v", userID, err)
+	}
+
+	// The old token is replayed after the grace period. The series is
+	// deleted.
+	t0 = t0.Add(2 * time.Minute)
+	old.cookie = first
+	if _, err := old.authenticate(m); err != ErrTheft {
+		t.Errorf("authenticate(replayed token) returned %v, want ErrTheft", err)
+	}
+	if len(stolen) != 1 || stolen[0] != "alice" {
+		t.Errorf("theft function called with %v", stolen)
+	}
+	if _, err := c.authenticate(m); err != ErrNoToken {
+		t.Errorf("authenticate after theft returned %v, want ErrNoToken", err)
+	}
+	if c.cookie != "" {
+		t.Errorf("cookie not deleted after rejection: %q", c.cookie)
+	}
+
+	// Expiration.
+	w = httptest.NewRecorder()
+	m.Login(ctx, w, "alice")
+	c.update(w)
+	t0 = t0.Add(time.Hour)
+	if _, err := c.authenticate(m); err != ErrNoToken {
+		t.Errorf("authenticate(expired) returned %v, want ErrNoToken", err)
+	}
+
+	// Logout of all devices.
+	var c1, c2 client
+	for _, c := range []*client{&c1, &c2} {
+		w := httptest.NewRecorder()
+		m.Login(ctx, w, "bob")
+		c.update(w)
+	}
+	if err := m.LogoutUser(ctx, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*client{&c1, &c2} {
+		if _, err := c.authenticate(m); err != ErrNoToken {
+			t.Errorf("authenticate after LogoutUser returned %v, want ErrNoToken", err)
+		}
+	}
+}
+
+// barrierStore holds the first n loads until all n loads have completed so
+// that concurrent requests load the same series.
+type barrierStore struct {
+	Store
+	mu sync.Mutex
+	n  int
+	wg sync.WaitGroup
+}
+
+func (bs *barrierStore) Load(ctx context.Context, selector string) (*Series, error) {
+	s, err := bs.Store.Load(ctx, selector)
+	bs.mu.Lock()
+	wait := bs.n > 0
+	bs.n--
+	bs.mu.Unlock()
+	if wait {
+		bs.wg.Done()
+		bs.wg.Wait()
+	}
+	return s, err
+}
+
+func TestConcurrentAuthenticate(t *testing.T) {
+	const n = 4
+	store := &barrierStore{Store: NewMemoryStore()}
+	codec := cookie.NewCodec("remember", cookie.WithHMACKeys([][]byte{[]byte("key")}))
+	stolen := false
+	m := NewManager(codec, store,
+		WithTheftFn(func(ctx context.Context, r *http.Request, userID string) { stolen = true }))
+
+	w := httptest.NewRecorder()
+	if err := m.Login(context.Background(), w, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	var c client
+	c.update(w)
+
+	store.n = n
+	store.wg.Add(n)
+	clients := make([]client, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range clients {
+		clients[i] = c
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var userID string
+			userID, errs[i] = clients[i].authenticate(m)
+			if errs[i] == nil && userID != "alice" {
+				errs[i] = errors.New("unexpected user " + userID)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("authenticate %d returned %v", i, err)
+		}
+	}
+	if stolen {
+		t.Error("theft function called for concurrent requests")
+	}
+
+	// One request rotated the validator. The new token is valid.
+	rotated := 0
+	for _, cc := range clients {
+		if cc.cookie != c.cookie {
+			rotated++
+			if _, err := cc.authenticate(m); err != nil {
+				t.Errorf("authenticate with rotated token returned %v", err)
+			}
+		}
+	}
+	if rotated != 1 {
+		t.Errorf("%d requests rotated the validator, want 1", rotated)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package remember
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/garyburd/web/sqlutil"
+	"golang.org/x/net/context"
+)
+
+// SQLStore stores series in a database table with the following columns:
+//
+//	selector       text primary key
+//	user_id        text, indexed
+//	hash           blob
+//	previous_hash  blob
+//	rotated        integer, rotation time in Unix seconds
+//	expires        integer, expiration time in Unix seconds
+//
+// The column types depend on the database. Expired series are deleted when
+// loaded and by the DeleteExpired method.
+type SQLStore struct {
+	db         *sql.DB
+	sc         *sqlutil.Context
+	load       string
+	insert     string
+	update     string
+	delete     string
+	deleteUser string
+	expired    string
+}
+
+type sqlRecord struct {
+	UserID       string `sql:"user_id"`
+	Hash         []byte `sql:"hash"`
+	PreviousHash []byte `sql:"previous_hash"`
+	Rotated      int64  `sql:"rotated"`
+	Expires      int64  `sql:"expires"`
+}
+
+// NewSQLStore returns a new SQL store using the given database and table.
+// The function placeholder returns the query parameter placeholder for the
+// argument with index i, starting at 1. If placeholder is nil, then "?" is
+// used. Use a function returning "$" + strconv.Itoa(i) for PostgreSQL.
+func NewSQLStore(db *sql.DB, table string, placeholder func(i int) string) *SQLStore {
+	if placeholder == nil {
+		placeholder = func(i int) string { return "?" }
+	}
+	p := make([]interface{}, 7)
+	for i := range p {
+		p[i] = placeholder(i + 1)
+	}
+	return &SQLStore{
+		db:   db,
+		sc:   &sqlutil.Context{MapName: strings.ToLower},
+		load: fmt.Sprintf("SELECT user_id, hash, previous_hash, rotated, expires FROM %s WHERE selector = %s", table, p[0]),
+		insert: fmt.Sprintf("INSERT INTO %s (selector, user_id, hash, previous_hash, rotated, expires) VALUES (%s, %s, %s, %s, %s, %s)",
+			append([]interface{}{table}, p[:6]...)...),
+		update: fmt.Sprintf("UPDATE %s SET user_id = %s, hash = %s, previous_hash = %s, rotated = %s, expires = %s WHERE selector = %s AND hash = %s",
+			append([]interface{}{table}, p...)...),
+		delete:     fmt.Sprintf("DELETE FROM %s WHERE selector = %s", table, p[0]),
+		deleteUser: fmt.Sprintf("DELETE FROM %s WHERE user_id = %s", table, p[0]),
+		expired:    fmt.Sprintf("DELETE FROM %s WHERE expires <= %s", table, p[0]),
+	}
+}
+
+// Load implements the Store interface.
+func (ss *SQLStore) Load(ctx context.Context, selector string) (*Series, error) {
+	rows, err := ss.db.QueryContext(ctx, ss.load, selector)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rec sqlRecord
+	err = ss.sc.ScanRow(rows, &rec)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if now().Unix() >= rec.Expires {
+		rows.Close()
+		if err := ss.Delete(ctx, selector); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+	return &Series{
+		Selector:     selector,
+		UserID:       rec.UserID,
+		Hash:         rec.Hash,
+		PreviousHash: rec.PreviousHash,
+		Rotated:      time.Unix(rec.Rotated, 0),
+		Expires:      time.Unix(rec.Expires, 0),
+	}, nil
+}
+
+// Save implements the Store interface. A new series is inserted. An existing
+// series is replaced with an update conditional on the stored hash.
+func (ss *SQLStore) Save(ctx context.Context, s *Series) error {
+	if s.PreviousHash == nil {
+		_, err := ss.db.ExecContext(ctx, ss.insert, s.Selector, s.UserID, s.Hash, s.PreviousHash,
+			s.Rotated.Unix(), s.Expires.Unix())
+		return err
+	}
+	result, err := ss.db.ExecContext(ctx, ss.update, s.UserID, s.Hash, s.PreviousHash,
+		s.Rotated.Unix(), s.Expires.Unix(), s.Selector, s.PreviousHash)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// Delete implements the Store interface.
+func (ss *SQLStore) Delete(ctx context.Context, selector string) error {
+	_, err := ss.db.ExecContext(ctx, ss.delete, selector)
+	return err
+}
+
+// DeleteUser implements the Store interface.
+func (ss *SQLStore) DeleteUser(ctx context.Context, userID string) error {
+	_, err := ss.db.ExecContext(ctx, ss.deleteUser, userID)
+	return err
+}
+
+// DeleteExpired deletes expired series.
+func (ss *SQLStore) DeleteExpired(ctx context.Context) error {
+	_, err := ss.db.ExecContext(ctx, ss.expired, now().Unix())
+	return err
+}
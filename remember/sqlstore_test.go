@@ -0,0 +1,23 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package remember
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/garyburd/web/internal/sqltest"
+	"golang.org/x/net/context"
+)
+
+func TestSQLStore(t *testing.T) {
+	store := NewSQLStore(sqltest.Open(), "series", nil)
+	testStore(t, store, func() error { return store.DeleteExpired(context.Background()) })
+}
+
+func TestSQLStorePlaceholder(t *testing.T) {
+	store := NewSQLStore(sqltest.Open(), "series", func(i int) string { return "$" + strconv.Itoa(i) })
+	testStore(t, store, func() error { return store.DeleteExpired(context.Background()) })
+}
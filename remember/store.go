@@ -0,0 +1,85 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package remember
+
+import (
+	"bytes"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// MemoryStore stores series in memory. Expired series are deleted when
+// loaded and by the DeleteExpired method.
+type MemoryStore struct {
+	mu     sync.Mutex
+	series map[string]Series
+}
+
+// NewMemoryStore returns a new memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{series: make(map[string]Series)}
+}
+
+// Load implements the Store interface.
+func (ms *MemoryStore) Load(ctx context.Context, selector string) (*Series, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	s, ok := ms.series[selector]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !now().Before(s.Expires) {
+		delete(ms.series, selector)
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+// Save implements the Store interface.
+func (ms *MemoryStore) Save(ctx context.Context, s *Series) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if s.PreviousHash != nil {
+		old, ok := ms.series[s.Selector]
+		if !ok || !bytes.Equal(old.Hash, s.PreviousHash) {
+			return ErrConflict
+		}
+	}
+	ms.series[s.Selector] = *s
+	return nil
+}
+
+// Delete implements the Store interface.
+func (ms *MemoryStore) Delete(ctx context.Context, selector string) error {
+	ms.mu.Lock()
+	delete(ms.series, selector)
+	ms.mu.Unlock()
+	return nil
+}
+
+// DeleteUser implements the Store interface.
+func (ms *MemoryStore) DeleteUser(ctx context.Context, userID string) error {
+	ms.mu.Lock()
+	for k, s := range ms.series {
+		if s.UserID == userID {
+			delete(ms.series, k)
+		}
+	}
+	ms.mu.Unlock()
+	return nil
+}
+
+// DeleteExpired deletes expired series.
+func (ms *MemoryStore) DeleteExpired() {
+	t := now()
+	ms.mu.Lock()
+	for k, s := range ms.series {
+		if !t.Before(s.Expires) {
+			delete(ms.series, k)
+		}
+	}
+	ms.mu.Unlock()
+}
@@ -0,0 +1,105 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package remember
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func testStore(t *testing.T, store Store, deleteExpired func() error) {
+	t0 := time.Unix(1136214245, 0)
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+	ctx := context.Background()
+
+	if _, err := store.Load(ctx, "a"); err != ErrNotFound {
+		t.Fatalf("Load(a) returned %v, want ErrNotFound", err)
+	}
+
+	a := &Series{Selector: "a", UserID: "alice", Hash: []byte("h1"), Rotated: t0, Expires: t0.Add(time.Minute)}
+	if err := store.Save(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := store.Load(ctx, "a"); err != nil || !reflect.DeepEqual(s, a) {
+		t.Fatalf("Load(a) = %+v, %v, want %+v", s, err, a)
+	}
+
+	// Rotation replaces the series only if the stored hash is the previous
+	// hash.
+	a2 := &Series{Selector: "a", UserID: "alice", Hash: []byte("h2"), PreviousHash: []byte("h1"), Rotated: t0, Expires: t0.Add(time.Minute)}
+	if err := store.Save(ctx, a2); err != nil {
+		t.Fatal(err)
+	}
+	a3 := &Series{Selector: "a", UserID: "alice", Hash: []byte("h3"), PreviousHash: []byte("h1"), Rotated: t0, Expires: t0.Add(time.Minute)}
+	if err := store.Save(ctx, a3); err != ErrConflict {
+		t.Fatalf("Save with stale previous hash returned %v, want ErrConflict", err)
+	}
+	if s, err := store.Load(ctx, "a"); err != nil || !reflect.DeepEqual(s, a2) {
+		t.Fatalf("Load(a) = %+v, %v, want %+v", s, err, a2)
+	}
+	x := &Series{Selector: "x", UserID: "alice", Hash: []byte("h2"), PreviousHash: []byte("h1"), Rotated: t0, Expires: t0.Add(time.Minute)}
+	if err := store.Save(ctx, x); err != ErrConflict {
+		t.Fatalf("Save of missing series returned %v, want ErrConflict", err)
+	}
+
+	for _, s := range []*Series{
+		{Selector: "b", UserID: "bob", Hash: []byte("b"), Rotated: t0, Expires: t0.Add(2 * time.Minute)},
+		{Selector: "c", UserID: "bob", Hash: []byte("c"), Rotated: t0, Expires: t0.Add(2 * time.Minute)},
+		{Selector: "d", UserID: "dave", Hash: []byte("d"), Rotated: t0, Expires: t0.Add(2 * time.Minute)},
+	} {
+		if err := store.Save(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t0 = t0.Add(time.Minute)
+	if _, err := store.Load(ctx, "a"); err != ErrNotFound {
+		t.Fatalf("Load(a) of expired series returned %v, want ErrNotFound", err)
+	}
+
+	if err := store.DeleteUser(ctx, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	for _, selector := range []string{"b", "c"} {
+		if _, err := store.Load(ctx, selector); err != ErrNotFound {
+			t.Fatalf("Load(%s) after DeleteUser returned %v, want ErrNotFound", selector, err)
+		}
+	}
+	if _, err := store.Load(ctx, "d"); err != nil {
+		t.Fatalf("Load(d) after DeleteUser(bob) returned %v", err)
+	}
+
+	if err := store.Delete(ctx, "d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "d"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(ctx, "d"); err != ErrNotFound {
+		t.Fatalf("Load(d) after Delete returned %v, want ErrNotFound", err)
+	}
+
+	e := &Series{Selector: "e", UserID: "eve", Hash: []byte("e"), Rotated: t0, Expires: t0.Add(time.Minute)}
+	if err := store.Save(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	t0 = t0.Add(time.Minute)
+	if err := deleteExpired(); err != nil {
+		t.Fatal(err)
+	}
+	now = time.Now
+	if _, err := store.Load(ctx, "e"); err != ErrNotFound {
+		t.Fatalf("Load(e) after DeleteExpired returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	testStore(t, store, func() error { store.DeleteExpired(); return nil })
+}
@@ -0,0 +1,62 @@
+// Copyright 2013 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import "time"
+
+// Group is a set of routes with a common pattern prefix and common settings.
+// Settings on a route take precedence over the settings on the route's group
+// and settings on a group take precedence over the settings on the parent
+// group.
+type Group struct {
+	router *Router
+	parent *Group
+	prefix string
+	limits
+}
+
+// Group creates a new group of routes. The prefix is prepended to the pattern
+// of routes added to the group. The prefix must be "" or begin with the
+// character '/'.
+func (router *Router) Group(prefix string) *Group {
+	if prefix != "" && prefix[0] != '/' {
+		panic("router: invalid group prefix " + prefix)
+	}
+	return &Group{router: router, prefix: prefix}
+}
+
+// Group creates a new group nested in this group.
+func (g *Group) Group(prefix string) *Group {
+	if prefix != "" && prefix[0] != '/' {
+		panic("router: invalid group prefix " + prefix)
+	}
+	return &Group{router: g.router, parent: g, prefix: g.prefix + prefix}
+}
+
+// Add adds a new route for the group prefix followed by the pattern.
+func (g *Group) Add(pat string) *Route {
+	route := g.router.Add(g.prefix + pat)
+	route.group = g
+	return route
+}
+
+// MaxBodyBytes sets the default maximum request body size for routes in the
+// group.
+func (g *Group) MaxBodyBytes(n int64) *Group {
+	g.maxBodyBytes = n
+	return g
+}
+
+// ReadTimeout sets the default request read timeout for routes in the group.
+func (g *Group) ReadTimeout(d time.Duration) *Group {
+	g.readTimeout = d
+	return g
+}
+
+// Timeout sets the default handler timeout for routes in the group.
+func (g *Group) Timeout(d time.Duration) *Group {
+	g.timeout = d
+	return g
+}
@@ -0,0 +1,169 @@
+// Copyright 2013 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/garyburd/web/httperror"
+	"golang.org/x/net/context"
+)
+
+// limits holds the request limits for a route or group. A zero value
+// indicates that the value is inherited from the enclosing group. A negative
+// value disables the limit.
+type limits struct {
+	maxBodyBytes int64
+	readTimeout  time.Duration
+	timeout      time.Duration
+}
+
+// MaxBodyBytes sets the maximum size of the request body. If the request
+// Content-Length exceeds the limit, then the router responds with status 413
+// without calling the handler. Otherwise, reads past the limit return an
+// error of type *http.MaxBytesError.
+func (route *Route) MaxBodyBytes(n int64) *Route {
+	route.maxBodyBytes = n
+	return route
+}
+
+// ReadTimeout sets a deadline for reading the request body. The deadline is
+// set on the connection when the request is dispatched to the handler.
+func (route *Route) ReadTimeout(d time.Duration) *Route {
+	route.readTimeout = d
+	return route
+}
+
+// Timeout sets the maximum duration for the handler. The handler context is
+// canceled when the timeout expires. If the handler has not returned by then,
+// the router responds with status 503 and discards the handler's output.
+func (route *Route) Timeout(d time.Duration) *Route {
+	route.timeout = d
+	return route
+}
+
+// effectiveLimits returns the route limits with unset values filled in from
+// the route's groups.
+func (route *Route) effectiveLimits() limits {
+	l := route.limits
+	for g := route.group; g != nil; g = g.parent {
+		if l.maxBodyBytes == 0 {
+			l.maxBodyBytes = g.maxBodyBytes
+		}
+		if l.readTimeout == 0 {
+			l.readTimeout = g.readTimeout
+		}
+		if l.timeout == 0 {
+			l.timeout = g.timeout
+		}
+	}
+	return l
+}
+
+// limitHandler wraps handler with the limits for route.
+func (router *Router) limitHandler(route *Route, handler Handler) Handler {
+	l := route.effectiveLimits()
+	if l.maxBodyBytes <= 0 && l.readTimeout <= 0 && l.timeout <= 0 {
+		return handler
+	}
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if l.maxBodyBytes > 0 && r.Body != nil {
+			if r.ContentLength > l.maxBodyBytes {
+				router.errfn(ctx, w, r, http.StatusRequestEntityTooLarge, httperror.ErrRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, l.maxBodyBytes)
+		}
+		if l.readTimeout > 0 {
+			// The error is ignored because not all response writers
+			// support deadlines.
+			http.NewResponseController(w).SetReadDeadline(time.Now().Add(l.readTimeout))
+		}
+		if l.timeout > 0 {
+			router.serveWithTimeout(ctx, w, r, l.timeout, handler)
+			return
+		}
+		handler(ctx, w, r)
+	}
+}
+
+func (router *Router) serveWithTimeout(ctx context.Context, w http.ResponseWriter, r *http.Request, timeout time.Duration, handler Handler) {
+	hctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tw := &timeoutWriter{header: make(http.Header)}
+	done := make(chan struct{})
+	panicChan := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicChan <- p
+			}
+		}()
+		handler(hctx, tw, r)
+		close(done)
+	}()
+
+	select {
+	case p := <-panicChan:
+		panic(p)
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		dst := w.Header()
+		for k, v := range tw.header {
+			dst[k] = v
+		}
+		if tw.code == 0 {
+			tw.code = http.StatusOK
+		}
+		w.WriteHeader(tw.code)
+		w.Write(tw.buf.Bytes())
+	case <-hctx.Done():
+		tw.mu.Lock()
+		tw.timedOut = true
+		tw.mu.Unlock()
+		router.errfn(ctx, w, r, http.StatusServiceUnavailable, &httperror.Error{
+			Status:  http.StatusServiceUnavailable,
+			Message: http.StatusText(http.StatusServiceUnavailable),
+			Err:     hctx.Err(),
+		})
+	}
+}
+
+// timeoutWriter buffers the response from a handler running with a timeout.
+type timeoutWriter struct {
+	header   http.Header
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.header }
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.code != 0 {
+		return
+	}
+	tw.code = code
+}
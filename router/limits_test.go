@@ -0,0 +1,96 @@
+// Copyright 2013 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garyburd/web/httperror"
+	"golang.org/x/net/context"
+)
+
+func readBodyHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	p, err := ioutil.ReadAll(r.Body)
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	w.Write(p)
+}
+
+func slowHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	<-ctx.Done()
+	w.Write([]byte("slow"))
+}
+
+var limitTests = []struct {
+	url    string
+	body   string
+	chunk  bool
+	status int
+	errv   error
+}{
+	{url: "/upload", body: "hello", status: http.StatusOK},
+	{url: "/upload", body: "hello world", status: http.StatusRequestEntityTooLarge, errv: httperror.ErrRequestEntityTooLarge},
+	{url: "/upload", body: "hello world", chunk: true, status: http.StatusRequestEntityTooLarge},
+	{url: "/api/echo", body: "0123456789", status: http.StatusOK},
+	{url: "/api/echo", body: "0123456789a", status: http.StatusRequestEntityTooLarge, errv: httperror.ErrRequestEntityTooLarge},
+	{url: "/api/big", body: "0123456789a", status: http.StatusOK},
+	{url: "/api/v1/echo", body: "0123456789a", status: http.StatusRequestEntityTooLarge, errv: httperror.ErrRequestEntityTooLarge},
+	{url: "/api/slow", status: http.StatusServiceUnavailable},
+	{url: "/api/v1/slow", status: http.StatusServiceUnavailable},
+	{url: "/fast", status: http.StatusOK},
+}
+
+func TestLimits(t *testing.T) {
+	var gotErr error
+	router := New()
+	router.ErrorFn(func(ctx context.Context, w http.ResponseWriter, r *http.Request, status int, err error) {
+		gotErr = err
+		w.WriteHeader(status)
+	})
+	router.Add("/upload").Post(readBodyHandler).MaxBodyBytes(5)
+	router.Add("/fast").Post(routeTestHandler("fast").Serve).Timeout(time.Second)
+	api := router.Group("/api").MaxBodyBytes(10).Timeout(10 * time.Millisecond)
+	api.Add("/echo").Post(readBodyHandler)
+	api.Add("/big").Post(readBodyHandler).MaxBodyBytes(20)
+	api.Add("/slow").Post(slowHandler)
+	v1 := api.Group("/v1")
+	v1.Add("/echo").Post(readBodyHandler)
+	v1.Add("/slow").Post(slowHandler)
+
+	for _, tt := range limitTests {
+		gotErr = nil
+		r := httptest.NewRequest("POST", tt.url, strings.NewReader(tt.body))
+		if tt.chunk {
+			r.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("url=%s body=%q, status=%d, want %d", tt.url, tt.body, w.Code, tt.status)
+			continue
+		}
+		if tt.errv != nil && gotErr != tt.errv {
+			t.Errorf("url=%s body=%q, err=%v, want %v", tt.url, tt.body, gotErr, tt.errv)
+		}
+		if w.Code == http.StatusServiceUnavailable {
+			e, ok := gotErr.(*httperror.Error)
+			if !ok || e.Status != http.StatusServiceUnavailable || e.Err != context.DeadlineExceeded {
+				t.Errorf("url=%s, err=%v, want 503 *httperror.Error with deadline exceeded", tt.url, gotErr)
+			}
+			if strings.Contains(w.Body.String(), "slow") {
+				t.Errorf("url=%s, body contains output of timed out handler", tt.url)
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2013 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/garyburd/web/header"
+	"golang.org/x/net/context"
+)
+
+type routeHandler struct {
+	handler  Handler
+	consumes []string
+	produces []string
+	version  string
+}
+
+type mediaTypeKey struct{}
+
+// MediaType returns the response media type selected by the router for the
+// request using the Produces media types of the matched handler.
+func MediaType(ctx context.Context) (string, bool) {
+	value, ok := ctx.Value(mediaTypeKey{}).(string)
+	return value, ok
+}
+
+func withMediaType(handler Handler, mediaType string, vary bool) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if vary {
+			w.Header().Add("Vary", "Accept")
+		}
+		handler(context.WithValue(ctx, mediaTypeKey{}, mediaType), w, r)
+	}
+}
+
+func lowerStrings(a []string) []string {
+	result := make([]string, len(a))
+	for i, s := range a {
+		result[i] = strings.ToLower(s)
+	}
+	return result
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Consumes sets the request media types accepted by the next handler added to
+// the route. Handlers added without a preceding call to Consumes accept all
+// requests. Unlike Produces, the media types do not apply to the handlers
+// added after the next handler. The media types can include wildcards of the form "type/*" and
+// "*/*". If the request has content and the request Content-Type does not
+// match the media types for any of the method's handlers, then the router
+// responds with status 415. Requests without content are not checked.
+func (route *Route) Consumes(mediaTypes ...string) *Route {
+	route.consumes = lowerStrings(mediaTypes)
+	return route
+}
+
+// Produces sets the response media types for all handlers subsequently added
+// to the route, until the next call to Produces. Unlike Consumes, the media
+// types are not cleared after the next handler is added. The router selects a handler by negotiating the media type using
+// the request Accept header. If no media type is acceptable, then the router
+// responds with status 406. Call the MediaType function to get the selected
+// media type in the handler. Call Produces with no arguments to clear the
+// media types.
+func (route *Route) Produces(mediaTypes ...string) *Route {
+	route.produces = lowerStrings(mediaTypes)
+	return route
+}
+
+func matchMediaType(pattern, mediaType string) bool {
+	switch {
+	case pattern == "*/*":
+		return true
+	case strings.HasSuffix(pattern, "/*"):
+		return strings.HasPrefix(mediaType, pattern[:len(pattern)-1])
+	default:
+		return pattern == mediaType
+	}
+}
+
+func consumes(rh *routeHandler, contentType string) bool {
+	if len(rh.consumes) == 0 {
+		return true
+	}
+	for _, pattern := range rh.consumes {
+		if matchMediaType(pattern, contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasContent returns true if the request has content.
+func hasContent(r *http.Request) bool {
+	return r.ContentLength != 0 || len(r.TransferEncoding) > 0
+}
+
+// selectHandler selects a handler using the request Content-Type and Accept
+// headers. The Content-Type is checked only when the request has content. If
+// a handler is not found, then the HTTP status for the error is returned.
+func selectHandler(handlers []*routeHandler, r *http.Request) (Handler, int) {
+	if len(handlers) == 1 && len(handlers[0].consumes) == 0 && len(handlers[0].produces) == 0 {
+		return handlers[0].handler, 0
+	}
+
+	candidates := handlers
+	if hasContent(r) {
+		contentType, _ := header.ParseValueAndParams(r.Header, "Content-Type")
+		candidates = nil
+		for _, rh := range handlers {
+			if consumes(rh, contentType) {
+				candidates = append(candidates, rh)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, http.StatusUnsupportedMediaType
+	}
+
+	var offers []string
+	var fallback *routeHandler
+	for _, rh := range candidates {
+		offers = append(offers, rh.produces...)
+		if len(rh.produces) == 0 && fallback == nil {
+			fallback = rh
+		}
+	}
+	if len(offers) == 0 {
+		return fallback.handler, 0
+	}
+
+	var mediaType string
+	if len(r.Header["Accept"]) == 0 {
+		mediaType = offers[0]
+	} else {
+		mediaType = header.NegotiateContentType(r, offers, "")
+	}
+	if mediaType == "" {
+		if fallback != nil {
+			return fallback.handler, 0
+		}
+		return nil, http.StatusNotAcceptable
+	}
+	for _, rh := range candidates {
+		for _, p := range rh.produces {
+			if p == mediaType {
+				return withMediaType(rh.handler, mediaType, len(offers) > 1), 0
+			}
+		}
+	}
+	panic("not reached")
+}
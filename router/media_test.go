@@ -0,0 +1,170 @@
+// Copyright 2013 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func mediaTestHandler(name string) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+		if mediaType, ok := MediaType(ctx); ok {
+			w.Write([]byte(" " + mediaType))
+		}
+	}
+}
+
+var mediaTests = []struct {
+	url         string
+	method      string
+	contentType string
+	content     string
+	accept      string
+	status      int
+	body        string
+}{
+	{url: "/a", method: "GET", status: http.StatusOK, body: "a-json application/json"},
+	{url: "/a", method: "GET", accept: "text/html", status: http.StatusOK, body: "a-html text/html"},
+	{url: "/a", method: "GET", accept: "text/*;q=0.5, application/json", status: http.StatusOK, body: "a-json application/json"},
+	{url: "/a", method: "GET", accept: "image/png", status: http.StatusNotAcceptable},
+	{url: "/a", method: "POST", contentType: "application/json; charset=utf-8", content: "{}", status: http.StatusOK, body: "a-post-json"},
+	{url: "/a", method: "POST", contentType: "application/x-www-form-urlencoded", content: "x=1", status: http.StatusOK, body: "a-post-form"},
+	{url: "/a", method: "POST", contentType: "text/plain", content: "x", status: http.StatusUnsupportedMediaType},
+	{url: "/a", method: "POST", content: "x", status: http.StatusUnsupportedMediaType},
+	{url: "/a", method: "POST", status: http.StatusOK, body: "a-post-json"},
+	{url: "/a", method: "POST", contentType: "text/plain", status: http.StatusOK, body: "a-post-json"},
+	{url: "/b", method: "PUT", contentType: "text/csv", content: "a,b", status: http.StatusOK, body: "b-text"},
+	{url: "/b", method: "PUT", contentType: "image/png", content: "x", status: http.StatusUnsupportedMediaType},
+	{url: "/b", method: "PUT", status: http.StatusOK, body: "b-text"},
+	{url: "/b", method: "GET", accept: "image/png", status: http.StatusOK, body: "b-any"},
+	{url: "/b", method: "GET", accept: "text/csv", status: http.StatusOK, body: "b-csv text/csv"},
+}
+
+func TestMediaTypes(t *testing.T) {
+	router := New()
+	router.Add("/a").
+		Produces("application/json").Get(mediaTestHandler("a-json")).
+		Produces("text/html").Get(mediaTestHandler("a-html")).
+		Produces().
+		Consumes("application/json").Post(mediaTestHandler("a-post-json")).
+		Consumes("application/x-www-form-urlencoded", "multipart/form-data").Post(mediaTestHandler("a-post-form"))
+	router.Add("/b").
+		Consumes("text/*").Method("PUT", mediaTestHandler("b-text")).
+		Get(mediaTestHandler("b-any")).
+		Produces("text/csv").Get(mediaTestHandler("b-csv"))
+
+	for _, tt := range mediaTests {
+		var body io.Reader
+		if tt.content != "" {
+			body = strings.NewReader(tt.content)
+		}
+		r := httptest.NewRequest(tt.method, tt.url, body)
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s %s content-type=%q accept=%q, status=%d, want %d", tt.method, tt.url, tt.contentType, tt.accept, w.Code, tt.status)
+			continue
+		}
+		if w.Code == http.StatusOK && w.Body.String() != tt.body {
+			t.Errorf("%s %s content-type=%q accept=%q, body=%q, want %q", tt.method, tt.url, tt.contentType, tt.accept, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestConsumesOrder(t *testing.T) {
+	router := New()
+	router.Add("/items").
+		Consumes("application/json").Post(mediaTestHandler("post")).
+		Get(mediaTestHandler("get")).
+		Method("PUT", mediaTestHandler("put"))
+
+	for _, tt := range []struct {
+		method      string
+		contentType string
+		status      int
+	}{
+		{"POST", "application/json", http.StatusOK},
+		{"POST", "text/plain", http.StatusUnsupportedMediaType},
+		{"GET", "", http.StatusOK},
+		{"PUT", "text/plain", http.StatusOK},
+	} {
+		var body io.Reader
+		if tt.contentType != "" {
+			body = strings.NewReader("x")
+		}
+		r := httptest.NewRequest(tt.method, "/items", body)
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s content-type=%q, status=%d, want %d", tt.method, tt.contentType, w.Code, tt.status)
+		}
+	}
+}
+
+func TestConsumesChunked(t *testing.T) {
+	router := New()
+	router.Add("/items").Consumes("application/json").Post(mediaTestHandler("post"))
+	r := httptest.NewRequest("POST", "/items", strings.NewReader("x"))
+	r.ContentLength = -1
+	r.TransferEncoding = []string{"chunked"}
+	r.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("status=%d, want %d", w.Code, http.StatusUnsupportedMediaType)
+	}
+}
+
+func TestProducesOrder(t *testing.T) {
+	router := New()
+	router.Add("/items").
+		Produces("application/json").Get(mediaTestHandler("get")).
+		Post(mediaTestHandler("post")).
+		Produces().Method("PUT", mediaTestHandler("put"))
+
+	for _, tt := range []struct {
+		method string
+		status int
+		body   string
+	}{
+		{"GET", http.StatusOK, "get application/json"},
+		{"POST", http.StatusOK, "post application/json"},
+		{"PUT", http.StatusOK, "put"},
+	} {
+		r := httptest.NewRequest(tt.method, "/items", nil)
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("%s status=%d body=%q, want %d %q", tt.method, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+
+	// The media types carry over, so a request that does not accept them
+	// is rejected for the POST handler.
+	r := httptest.NewRequest("POST", "/items", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("POST accept=text/html status=%d, want %d", w.Code, http.StatusNotAcceptable)
+	}
+}
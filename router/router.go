@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"path"
 	"regexp"
+	"sort"
 	"strings"
 
 	"golang.org/x/net/context"
@@ -60,6 +61,9 @@ type Handler func(ctx context.Context, w http.ResponseWriter, r *http.Request)
 // If a matching route is found, then the router looks for a handler using the
 // request method, "GET" if the request method is "HEAD" and "*". If a handler
 // is not found, then the router responds to the request with HTTP status 405.
+// If the route's handlers for the method declare media types with Consumes or
+// Produces, then the router selects a handler using the request Content-Type
+// and Accept headers or responds with HTTP status 415 or 406.
 //
 // Call the PathaParams function to get the matched parameter values for a
 // context.
@@ -69,15 +73,26 @@ type Handler func(ctx context.Context, w http.ResponseWriter, r *http.Request)
 type Router struct {
 	simpleMatch map[string]*Route
 	routes      []*Route
+	allRoutes   []*Route
 	errfn       ErrorFn
 	useURLPath  bool
+	versionFns  []VersionFn
 }
 
 type Route struct {
 	pat      string
 	addSlash bool
 	cpat     *regexp.Regexp
-	handlers map[string]Handler
+	handlers map[string][]*routeHandler
+	consumes []string
+	produces []string
+	version  string
+	versions []*versionInfo
+	name     string
+	sitemap  *sitemapOptions
+	noIndex  bool
+	group    *Group
+	limits
 }
 
 var parameterRegexp = regexp.MustCompile("<([A-Za-z0-9_]*)(:[^>]*)?>")
@@ -132,10 +147,11 @@ func (router *Router) Add(pat string) *Route {
 	addSlash := pat != "/" && pat[len(pat)-1] == '/'
 	route := &Route{
 		pat:      pat,
-		handlers: make(map[string]Handler),
+		handlers: make(map[string][]*routeHandler),
 		addSlash: addSlash,
 		cpat:     compilePattern(pat, addSlash, "/"),
 	}
+	router.allRoutes = append(router.allRoutes, route)
 	if route.cpat != nil {
 		router.routes = append(router.routes, route)
 	} else {
@@ -153,10 +169,48 @@ func (router *Router) Add(pat string) *Route {
 	return route
 }
 
+// Name sets the name of the route.
+func (route *Route) Name(name string) *Route {
+	route.name = name
+	return route
+}
+
+// Info returns a description of the route.
+func (route *Route) Info() RouteInfo {
+	info := RouteInfo{Name: route.name, Pattern: route.pat}
+	for method := range route.handlers {
+		info.Methods = append(info.Methods, method)
+	}
+	sort.Strings(info.Methods)
+	return info
+}
+
+// RouteInfo describes a route.
+type RouteInfo struct {
+	Name    string   // Name set with the Route Name method.
+	Pattern string   // Path pattern.
+	Methods []string // Methods with handlers, sorted.
+}
+
 // Method sets the handler for the given HTTP request method. Use "*" to match
 // all methods.
+//
+// The handler is associated with the request media types set by the
+// preceding call to Consumes and with the response media types and version
+// set by the most recent calls to Produces and Version. A route can have
+// more than one handler for a method if the handlers have different media
+// types or versions. Setting a handler for the same method, media types and
+// version replaces the previous handler.
 func (route *Route) Method(method string, handler Handler) *Route {
-	route.handlers[method] = handler
+	rh := &routeHandler{handler: handler, consumes: route.consumes, produces: route.produces, version: route.version}
+	route.consumes = nil
+	for i, h := range route.handlers[method] {
+		if equalStrings(h.consumes, rh.consumes) && equalStrings(h.produces, rh.produces) && h.version == rh.version {
+			route.handlers[method][i] = rh
+			return route
+		}
+	}
+	route.handlers[method] = append(route.handlers[method], rh)
 	return route
 }
 
@@ -199,9 +253,22 @@ func (router *Router) findRoute(path string) (*Route, []string, []string) {
 	return nil, nil, nil
 }
 
+// methodHandlers returns the handlers for the request method, "GET" if the
+// request method is "HEAD" and "*".
+func (route *Route) methodHandlers(method string) []*routeHandler {
+	handlers := route.handlers[method]
+	if handlers == nil && method == "HEAD" {
+		handlers = route.handlers["GET"]
+	}
+	if handlers == nil {
+		handlers = route.handlers["*"]
+	}
+	return handlers
+}
+
 // find the handler and path parameters using the path component of the request
-// URL and the request method.
-func (router *Router) findHandler(path, method string) (Handler, []string, []string) {
+// URL, the request method and the request headers.
+func (router *Router) findHandler(path string, r *http.Request) (Handler, []string, []string) {
 	route, names, values := router.findRoute(path)
 	if route == nil {
 		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) { router.errfn(ctx, w, r, 404, nil) }, nil, nil
@@ -209,17 +276,20 @@ func (router *Router) findHandler(path, method string) (Handler, []string, []str
 	if route.addSlash && path[len(path)-1] != '/' {
 		return addSlash, nil, nil
 	}
-	handler := route.handlers[method]
-	if handler == nil && method == "HEAD" {
-		handler = route.handlers["GET"]
+	handlers := route.methodHandlers(r.Method)
+	if handlers == nil {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) { router.errfn(ctx, w, r, 405, nil) }, nil, nil
 	}
-	if handler == nil {
-		handler = route.handlers["*"]
+	if route.versions != nil {
+		return router.limitHandler(route, router.versionHandler(route, handlers)), names, values
 	}
+	handler, status := selectHandler(handlers, r)
 	if handler == nil {
-		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) { router.errfn(ctx, w, r, 405, nil) }, nil, nil
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			router.errfn(ctx, w, r, status, nil)
+		}, nil, nil
 	}
-	return handler, names, values
+	return router.limitHandler(route, handler), names, values
 }
 
 const notHex = 127
@@ -275,49 +345,101 @@ func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	router.Serve(context.Background(), w, r)
 }
 
-// Serve dispatches the request to a registered handler.
-func (router *Router) Serve(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	var (
-		handler       Handler
-		names, values []string
-	)
+// requestPath returns the path used to route the request. If the path is not
+// clean, then the URL of the clean path is returned as redirect.
+func (router *Router) requestPath(r *http.Request) (p string, redirect string) {
 	if router.useURLPath {
-		handler, names, values = router.findHandler(r.URL.Path, r.Method)
-	} else {
-		p := r.RequestURI
-		q := ""
-		if i := strings.Index(p, "?"); i >= 0 {
-			q = p[i:]
-			p = p[:i]
+		return r.URL.Path, ""
+	}
+	p = r.RequestURI
+	q := ""
+	if i := strings.Index(p, "?"); i >= 0 {
+		q = p[i:]
+		p = p[:i]
+	}
+	cp := "/"
+	if p != "" && p != "/" {
+		slash := p[len(p)-1] == '/'
+		cp = path.Clean(p)
+		if slash {
+			cp += "/"
 		}
-		cp := "/"
-		if p != "" && p != "/" {
-			slash := p[len(p)-1] == '/'
-			cp = path.Clean(p)
-			if slash {
-				cp += "/"
-			}
+	}
+	if p != cp {
+		return "", cp + q
+	}
+	return p, ""
+}
+
+// decodeParams percent decodes the parameter values in place when the router
+// routes on the request URI.
+func (router *Router) decodeParams(names, values []string) error {
+	if router.useURLPath {
+		return nil
+	}
+	for i, value := range values {
+		if names[i] == "" {
+			continue
 		}
-		if p != cp {
-			http.Redirect(w, r, cp+q, 301)
-			return
+		var err error
+		values[i], err = percentDecode(value)
+		if err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		handler, names, values = router.findHandler(p, r.Method)
-		for i, value := range values {
-			if names[i] == "" {
-				continue
-			}
-			var err error
-			values[i], err = percentDecode(value)
-			if err != nil {
-				router.errfn(ctx, w, r, http.StatusBadRequest, nil)
-				return
-			}
+// Serve dispatches the request to a registered handler.
+func (router *Router) Serve(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	p, redirect := router.requestPath(r)
+	if redirect != "" {
+		http.Redirect(w, r, redirect, 301)
+		return
+	}
+	handler, names, values := router.findHandler(p, r)
+	if err := router.decodeParams(names, values); err != nil {
+		router.errfn(ctx, w, r, http.StatusBadRequest, nil)
+		return
+	}
+	handler(withParams(ctx, names, values), w, r)
+}
+
+// Resolve returns the route and parameters that the router uses to dispatch
+// the request without calling a handler. The status is http.StatusOK if the
+// route has a handler for the request method. Otherwise, the status is the
+// HTTP status of the response that the router sends for the request. Resolve
+// does not select handlers by media type or version.
+func (router *Router) Resolve(r *http.Request) (*Route, map[string]string, int) {
+	p, redirect := router.requestPath(r)
+	if redirect != "" {
+		return nil, nil, http.StatusMovedPermanently
+	}
+	route, names, values := router.findRoute(p)
+	if route == nil {
+		return nil, nil, http.StatusNotFound
+	}
+	if route.addSlash && p[len(p)-1] != '/' {
+		return route, nil, http.StatusMovedPermanently
+	}
+	if route.methodHandlers(r.Method) == nil {
+		return route, nil, http.StatusMethodNotAllowed
+	}
+	if err := router.decodeParams(names, values); err != nil {
+		return route, nil, http.StatusBadRequest
+	}
+	params := make(map[string]string)
+	for i, name := range names {
+		if name != "" {
+			params[name] = values[i]
 		}
 	}
+	return route, params, http.StatusOK
+}
 
-	handler(withParams(ctx, names, values), w, r)
+// Routes returns the routes in the order that the routes were added.
+func (router *Router) Routes() []*Route {
+	return append([]*Route(nil), router.allRoutes...)
 }
 
 // Error sets the function used to generate error responses from the router.
@@ -361,6 +483,7 @@ type HostRouter struct {
 type hostRoute struct {
 	cpat    *regexp.Regexp
 	handler Handler
+	router  *Router
 	pat     string
 }
 
@@ -382,9 +505,20 @@ func (router *HostRouter) ErrorFn(errfn ErrorFn) {
 
 // Add adds a handler for the given pattern.
 func (router *HostRouter) Add(pat string, handler Handler) {
+	router.add(pat, handler, nil)
+}
+
+// AddRouter adds a router for the given pattern. Unlike a router added with
+// Add, the routes of a router added with AddRouter are found by Resolve.
+func (router *HostRouter) AddRouter(pat string, r *Router) {
+	router.add(pat, r.Serve, r)
+}
+
+func (router *HostRouter) add(pat string, handler Handler, r *Router) {
 	route := &hostRoute{
 		cpat:    compilePattern(pat, false, "."),
 		handler: handler,
+		router:  r,
 		pat:     pat,
 	}
 	if route.cpat != nil {
@@ -426,6 +560,22 @@ func (router *HostRouter) Serve(ctx context.Context, w http.ResponseWriter, r *h
 	route.handler(withParams(ctx, names, values), w, r)
 }
 
+// Resolve finds the route for the request host and path without calling a
+// handler. Resolve returns status http.StatusNotFound if no pattern matches
+// the host. If the handler for the host was added with AddRouter, then
+// Resolve returns the result of the router's Resolve method. Otherwise,
+// Resolve returns status 0 because the routes for the host are not known.
+func (router *HostRouter) Resolve(r *http.Request) (*Route, map[string]string, int) {
+	route, _, _ := router.findRoute(strings.ToLower(StripPort(r.Host)))
+	switch {
+	case route == nil:
+		return nil, nil, http.StatusNotFound
+	case route.router == nil:
+		return nil, nil, 0
+	}
+	return route.router.Resolve(r)
+}
+
 // StripPort removes the port specification from an address.
 func StripPort(s string) string {
 	if h, _, err := net.SplitHostPort(s); err == nil {
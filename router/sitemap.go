@@ -0,0 +1,300 @@
+// Copyright 2013 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// sitemapLimit is the maximum number of URLs in a sitemap file. It's a
+// variable so that tests can change it.
+var sitemapLimit = 50000
+
+// EnumerateFn returns the parameter values for the URLs of a route with a
+// parameterized pattern. Each map in the result specifies the values for one
+// URL.
+type EnumerateFn func(ctx context.Context) ([]map[string]string, error)
+
+type sitemapOptions struct {
+	changeFreq string
+	priority   float64 // -1 if not set
+	enumerate  EnumerateFn
+}
+
+func (route *Route) sitemapOptions() *sitemapOptions {
+	if route.sitemap == nil {
+		route.sitemap = &sitemapOptions{priority: -1}
+	}
+	return route.sitemap
+}
+
+// Public marks the route as public. Public routes are included in the sitemap
+// served by the router's sitemap handler. Routes with parameters are included
+// only if an enumerator is set with the Enumerate method.
+func (route *Route) Public() *Route {
+	route.sitemapOptions()
+	return route
+}
+
+var validChangeFreqs = map[string]bool{
+	"always":  true,
+	"hourly":  true,
+	"daily":   true,
+	"weekly":  true,
+	"monthly": true,
+	"yearly":  true,
+	"never":   true,
+}
+
+// ChangeFreq marks the route as public and sets the sitemap change frequency.
+// Valid values are "always", "hourly", "daily", "weekly", "monthly", "yearly"
+// and "never".
+func (route *Route) ChangeFreq(freq string) *Route {
+	if !validChangeFreqs[freq] {
+		panic("router: invalid change frequency " + freq)
+	}
+	route.sitemapOptions().changeFreq = freq
+	return route
+}
+
+// Priority marks the route as public and sets the sitemap priority. The
+// priority must be in the range 0.0 to 1.0.
+func (route *Route) Priority(priority float64) *Route {
+	if priority < 0 || priority > 1 {
+		panic("router: invalid priority " + strconv.FormatFloat(priority, 'g', -1, 64))
+	}
+	route.sitemapOptions().priority = priority
+	return route
+}
+
+// Enumerate marks the route as public and sets the function used to get the
+// parameter values for the route's URLs in the sitemap.
+func (route *Route) Enumerate(fn EnumerateFn) *Route {
+	route.sitemapOptions().enumerate = fn
+	return route
+}
+
+// NoIndex excludes the route from crawling. The robots handler lists the
+// route in a Disallow rule.
+func (route *Route) NoIndex() *Route {
+	route.noIndex = true
+	return route
+}
+
+var errMissingParam = errors.New("router: missing parameter value")
+
+// expandPattern returns the path for the pattern with the parameters replaced
+// by the given values.
+func (route *Route) expandPattern(params map[string]string) (string, error) {
+	pat := route.pat
+	var buf []byte
+	for {
+		a := parameterRegexp.FindStringSubmatchIndex(pat)
+		if len(a) == 0 {
+			buf = append(buf, pat...)
+			break
+		}
+		buf = append(buf, pat[:a[0]]...)
+		value, ok := params[pat[a[2]:a[3]]]
+		if !ok || value == "" {
+			return "", errMissingParam
+		}
+		buf = append(buf, url.PathEscape(value)...)
+		pat = pat[a[1]:]
+	}
+	p := string(buf)
+	if route.cpat != nil && !route.cpat.MatchString(p) {
+		return "", errors.New("router: parameter values do not match pattern " + route.pat)
+	}
+	return p, nil
+}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+// formatPriority formats a sitemap priority with at least one decimal place
+// and without rounding.
+func formatPriority(priority float64) string {
+	s := strconv.FormatFloat(priority, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// sitemapURLs returns the sitemap entries for the public routes in the order
+// that the routes were added.
+func (router *Router) sitemapURLs(ctx context.Context, baseURL string) ([]sitemapURL, error) {
+	var urls []sitemapURL
+	for _, route := range router.allRoutes {
+		if route.sitemap == nil {
+			continue
+		}
+		u := sitemapURL{ChangeFreq: route.sitemap.changeFreq}
+		if route.sitemap.priority >= 0 {
+			u.Priority = formatPriority(route.sitemap.priority)
+		}
+		if route.cpat == nil {
+			u.Loc = baseURL + route.pat
+			urls = append(urls, u)
+			continue
+		}
+		if route.sitemap.enumerate == nil {
+			continue
+		}
+		paramsList, err := route.sitemap.enumerate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, params := range paramsList {
+			p, err := route.expandPattern(params)
+			if err != nil {
+				return nil, err
+			}
+			u.Loc = baseURL + p
+			urls = append(urls, u)
+		}
+	}
+	return urls, nil
+}
+
+// requestBaseURL returns the scheme and host for the request.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) error {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write(buf.Bytes())
+	return nil
+}
+
+// SitemapHandler returns a handler that serves a sitemap for the public
+// routes. The baseURL is the scheme and host prepended to the route paths,
+// for example "https://example.com". If baseURL is "", then the scheme and
+// host are taken from the request.
+//
+// If the number of URLs exceeds the 50,000 URL limit for a sitemap file, then
+// the handler serves a sitemap index. The sitemaps in the index are served by
+// the same handler using the query parameter "page".
+func (router *Router) SitemapHandler(baseURL string) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		base := baseURL
+		if base == "" {
+			base = requestBaseURL(r)
+		}
+		urls, err := router.sitemapURLs(ctx, base)
+		if err != nil {
+			router.errfn(ctx, w, r, http.StatusInternalServerError, err)
+			return
+		}
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			if len(urls) <= sitemapLimit {
+				err = writeXML(w, &sitemapURLSet{URLs: urls})
+			} else {
+				var index sitemapIndex
+				for i := 1; (i-1)*sitemapLimit < len(urls); i++ {
+					index.Sitemaps = append(index.Sitemaps, sitemapLoc{Loc: base + r.URL.Path + "?page=" + strconv.Itoa(i)})
+				}
+				err = writeXML(w, &index)
+			}
+		} else {
+			n, perr := strconv.Atoi(page)
+			if perr != nil || n < 1 || (n-1)*sitemapLimit >= len(urls) {
+				router.errfn(ctx, w, r, http.StatusNotFound, nil)
+				return
+			}
+			urls = urls[(n-1)*sitemapLimit:]
+			if len(urls) > sitemapLimit {
+				urls = urls[:sitemapLimit]
+			}
+			err = writeXML(w, &sitemapURLSet{URLs: urls})
+		}
+		if err != nil {
+			router.errfn(ctx, w, r, http.StatusInternalServerError, err)
+		}
+	}
+}
+
+// robotsPath converts a route pattern to a robots.txt path. Parameters are
+// replaced with the '*' wildcard and patterns without a trailing parameter
+// are anchored with '$'.
+func robotsPath(pat string) string {
+	p := parameterRegexp.ReplaceAllString(pat, "*")
+	if !strings.HasSuffix(p, "*") {
+		p += "$"
+	}
+	return p
+}
+
+// RobotsHandler returns a handler that serves a robots.txt file. The file
+// disallows the routes marked with NoIndex and references the sitemap at
+// sitemapPath. If sitemapPath is "", then the sitemap reference is omitted.
+// The baseURL is used as in SitemapHandler.
+func (router *Router) RobotsHandler(baseURL, sitemapPath string) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		buf.WriteString("User-agent: *\n")
+		n := 0
+		for _, route := range router.allRoutes {
+			if route.noIndex {
+				buf.WriteString("Disallow: ")
+				buf.WriteString(robotsPath(route.pat))
+				buf.WriteByte('\n')
+				n++
+			}
+		}
+		if n == 0 {
+			buf.WriteString("Disallow:\n")
+		}
+		if sitemapPath != "" {
+			base := baseURL
+			if base == "" {
+				base = requestBaseURL(r)
+			}
+			buf.WriteString("\nSitemap: ")
+			buf.WriteString(base)
+			buf.WriteString(sitemapPath)
+			buf.WriteByte('\n')
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(buf.Bytes())
+	}
+}
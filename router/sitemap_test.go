@@ -0,0 +1,96 @@
+// Copyright 2013 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func newSitemapTestRouter() *Router {
+	router := New()
+	h := routeTestHandler("x").Serve
+	router.Add("/").Get(h).Public().ChangeFreq("daily").Priority(1)
+	router.Add("/about").Get(h).Public().Priority(0.25)
+	router.Add("/admin/").Get(h).NoIndex()
+	router.Add("/items/<x>").Get(h).Enumerate(func(ctx context.Context) ([]map[string]string, error) {
+		return []map[string]string{{"x": "a b"}, {"x": "c/d"}}, nil
+	})
+	router.Add("/users/<x>/edit").Get(h).NoIndex()
+	router.Add("/hidden/<x>").Get(h).Public()
+	router.Add("/sitemap.xml").Get(router.SitemapHandler("https://example.com"))
+	router.Add("/robots.txt").Get(router.RobotsHandler("", "/sitemap.xml"))
+	return router
+}
+
+func serveTestRequest(router *Router, rawurl string) *httptest.ResponseRecorder {
+	u, _ := url.Parse(rawurl)
+	r := &http.Request{URL: u, RequestURI: rawurl, Method: "GET", Host: "example.org"}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestSitemap(t *testing.T) {
+	router := newSitemapTestRouter()
+	w := serveTestRequest(router, "/sitemap.xml")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d, want %d", w.Code, http.StatusOK)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` +
+		`<url><loc>https://example.com/</loc><changefreq>daily</changefreq><priority>1.0</priority></url>` +
+		`<url><loc>https://example.com/about</loc><priority>0.25</priority></url>` +
+		`<url><loc>https://example.com/items/a%20b</loc></url>` +
+		`<url><loc>https://example.com/items/c%2Fd</loc></url>` +
+		`</urlset>`
+	if got := w.Body.String(); got != want {
+		t.Errorf("body=\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSitemapIndex(t *testing.T) {
+	defer func(n int) { sitemapLimit = n }(sitemapLimit)
+	sitemapLimit = 3
+	router := newSitemapTestRouter()
+
+	w := serveTestRequest(router, "/sitemap.xml")
+	for _, s := range []string{
+		"<sitemapindex ",
+		"<loc>https://example.com/sitemap.xml?page=1</loc>",
+		"<loc>https://example.com/sitemap.xml?page=2</loc>",
+	} {
+		if !strings.Contains(w.Body.String(), s) {
+			t.Errorf("index %q does not contain %q", w.Body.String(), s)
+		}
+	}
+
+	w = serveTestRequest(router, "/sitemap.xml?page=2")
+	if n := strings.Count(w.Body.String(), "<url>"); n != 1 {
+		t.Errorf("page 2 has %d URLs, want 1", n)
+	}
+
+	w = serveTestRequest(router, "/sitemap.xml?page=3")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("page 3 status=%d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestRobots(t *testing.T) {
+	router := newSitemapTestRouter()
+	w := serveTestRequest(router, "/robots.txt")
+	want := "User-agent: *\n" +
+		"Disallow: /admin/$\n" +
+		"Disallow: /users/*/edit$\n" +
+		"\nSitemap: http://example.org/sitemap.xml\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("body=\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2013 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/web/header"
+	"golang.org/x/net/context"
+)
+
+// VersionFn returns the API version specified by a request or "" if the
+// request does not specify a version.
+type VersionFn func(ctx context.Context, r *http.Request) string
+
+type varyKey struct{}
+
+// addVary records that the response varies by the named request header.
+func addVary(ctx context.Context, name string) {
+	if vary, ok := ctx.Value(varyKey{}).(*[]string); ok {
+		for _, v := range *vary {
+			if v == name {
+				return
+			}
+		}
+		*vary = append(*vary, name)
+	}
+}
+
+// VersionFromAccept returns a version function that gets the version from the
+// named media type parameter in the Accept header. For example, the version
+// in the header "Accept: application/vnd.example+json; version=2" is "2" when
+// the parameter name is "version".
+func VersionFromAccept(param string) VersionFn {
+	return func(ctx context.Context, r *http.Request) string {
+		addVary(ctx, "Accept")
+		for _, s := range header.ParseList(r.Header, "Accept") {
+			_, params := header.ParseValueAndParams(http.Header{"Accept": {s}}, "Accept")
+			if v := params[param]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+}
+
+// VersionFromHeader returns a version function that gets the version from the
+// named request header.
+func VersionFromHeader(name string) VersionFn {
+	return func(ctx context.Context, r *http.Request) string {
+		addVary(ctx, http.CanonicalHeaderKey(name))
+		return r.Header.Get(name)
+	}
+}
+
+// VersionFromParam returns a version function that gets the version from the
+// named route parameter. Use a pattern or group prefix like "/v<version>" to
+// specify the version with a path prefix.
+func VersionFromParam(name string) VersionFn {
+	return func(ctx context.Context, r *http.Request) string {
+		v, _ := Param(ctx, name)
+		return v
+	}
+}
+
+// Versioning sets the functions used to get the API version from a request.
+// The functions are called in order until a function returns a version.
+func (router *Router) Versioning(fns ...VersionFn) {
+	router.versionFns = fns
+}
+
+type versionKey struct{}
+
+// RequestVersion returns the API version of the handler selected by the
+// router.
+func RequestVersion(ctx context.Context) (string, bool) {
+	value, ok := ctx.Value(versionKey{}).(string)
+	return value, ok
+}
+
+type versionInfo struct {
+	version     string
+	deprecation time.Time
+	sunset      time.Time
+}
+
+func (route *Route) versionInfo(version string) *versionInfo {
+	for _, vi := range route.versions {
+		if vi.version == version {
+			return vi
+		}
+	}
+	vi := &versionInfo{version: version}
+	route.versions = append(route.versions, vi)
+	return vi
+}
+
+// Version sets the API version for handlers subsequently added to the route.
+// Handlers added before the first call to Version or after a call to Version
+// with "" are used for all versions.
+//
+// If the request does not specify a version, then the router uses the first
+// version added to the route. If the request specifies a version not added to
+// the route, then the router responds with HTTP status 404.
+func (route *Route) Version(version string) *Route {
+	if version != "" {
+		route.versionInfo(version)
+	}
+	route.version = version
+	return route
+}
+
+// Deprecate marks the version as deprecated at the given time. Responses from
+// the version's handlers include the Deprecation header and, if sunset is not
+// zero, the Sunset header. Deprecate panics if the version was not added to
+// the route with Version.
+func (route *Route) Deprecate(version string, at, sunset time.Time) *Route {
+	var vi *versionInfo
+	for _, v := range route.versions {
+		if v.version == version {
+			vi = v
+			break
+		}
+	}
+	if vi == nil {
+		panic("router: deprecated version " + version + " not added to route " + route.pat)
+	}
+	vi.deprecation = at
+	vi.sunset = sunset
+	return route
+}
+
+// requestVersion returns the version specified by the request. The response
+// Vary header is set to the request headers used to find the version.
+func (router *Router) requestVersion(ctx context.Context, w http.ResponseWriter, r *http.Request) string {
+	var vary []string
+	ctx = context.WithValue(ctx, varyKey{}, &vary)
+	version := ""
+	for _, fn := range router.versionFns {
+		if version = fn(ctx, r); version != "" {
+			break
+		}
+	}
+	for _, name := range vary {
+		w.Header().Add("Vary", name)
+	}
+	return version
+}
+
+// versionMethods returns the sorted methods with handlers for the version or
+// for all versions.
+func (route *Route) versionMethods(version string) []string {
+	var methods []string
+	for method, handlers := range route.handlers {
+		if method == "*" {
+			continue
+		}
+		for _, rh := range handlers {
+			if rh.version == "" || rh.version == version {
+				methods = append(methods, method)
+				if method == "GET" && route.handlers["HEAD"] == nil {
+					methods = append(methods, "HEAD")
+				}
+				break
+			}
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// versionHandler returns a handler that selects the handler for the version
+// specified by the request.
+func (router *Router) versionHandler(route *Route, handlers []*routeHandler) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		version := router.requestVersion(ctx, w, r)
+		if version == "" {
+			version = route.versions[0].version
+		}
+		var vi *versionInfo
+		for _, v := range route.versions {
+			if v.version == version {
+				vi = v
+				break
+			}
+		}
+		if vi == nil {
+			router.errfn(ctx, w, r, http.StatusNotFound, nil)
+			return
+		}
+		// Handlers for the version take priority over handlers for all
+		// versions.
+		var vhandlers []*routeHandler
+		for _, rh := range handlers {
+			if rh.version == version {
+				vhandlers = append(vhandlers, rh)
+			}
+		}
+		for _, rh := range handlers {
+			if rh.version == "" {
+				vhandlers = append(vhandlers, rh)
+			}
+		}
+		if vhandlers == nil {
+			// The method has handlers for other versions only.
+			w.Header().Set("Allow", strings.Join(route.versionMethods(version), ", "))
+			router.errfn(ctx, w, r, http.StatusMethodNotAllowed, nil)
+			return
+		}
+		handler, status := selectHandler(vhandlers, r)
+		if handler == nil {
+			router.errfn(ctx, w, r, status, nil)
+			return
+		}
+		if !vi.deprecation.IsZero() {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(vi.deprecation.Unix(), 10))
+		}
+		if !vi.sunset.IsZero() {
+			w.Header().Set("Sunset", vi.sunset.UTC().Format(http.TimeFormat))
+		}
+		handler(context.WithValue(ctx, versionKey{}, version), w, r)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2013 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func versionTestHandler(name string) Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+		if version, ok := RequestVersion(ctx); ok {
+			w.Write([]byte(" " + version))
+		}
+	}
+}
+
+var versionTests = []struct {
+	url         string
+	method      string
+	accept      string
+	version     string
+	status      int
+	body        string
+	deprecation string
+	sunset      string
+	allow       string
+}{
+	{url: "/items", method: "GET", status: http.StatusOK, body: "items-v1 1", deprecation: "@1136214245", sunset: "Thu, 02 Feb 2006 15:04:05 GMT"},
+	{url: "/items", method: "GET", accept: "application/vnd.example+json; version=2", status: http.StatusOK, body: "items-v2 2"},
+	{url: "/items", method: "GET", accept: "application/vnd.example+json; version=3", status: http.StatusNotFound},
+	{url: "/items", method: "GET", version: "2", status: http.StatusOK, body: "items-v2 2"},
+	{url: "/items", method: "GET", version: "2", accept: "application/vnd.example+json; version=1", status: http.StatusOK, body: "items-v1 1", deprecation: "@1136214245", sunset: "Thu, 02 Feb 2006 15:04:05 GMT"},
+	{url: "/items", method: "POST", version: "2", status: http.StatusOK, body: "items-post 2"},
+	{url: "/items", method: "DELETE", version: "1", status: http.StatusMethodNotAllowed, allow: "GET, HEAD, POST"},
+	{url: "/items", method: "DELETE", version: "2", status: http.StatusOK, body: "items-delete 2"},
+	{url: "/v1/users", method: "GET", status: http.StatusOK, body: "users-v1 1"},
+	{url: "/v2/users", method: "GET", status: http.StatusOK, body: "users-v2 2"},
+	{url: "/v3/users", method: "GET", status: http.StatusNotFound},
+	{url: "/plain", method: "GET", version: "2", status: http.StatusOK, body: "plain"},
+}
+
+func TestVersion(t *testing.T) {
+	deprecated := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	router := New()
+	router.Versioning(VersionFromAccept("version"), VersionFromHeader("X-API-Version"), VersionFromParam("version"))
+	router.Add("/items").
+		Post(versionTestHandler("items-post")).
+		Version("1").Get(versionTestHandler("items-v1")).
+		Version("2").Get(versionTestHandler("items-v2")).Method("DELETE", versionTestHandler("items-delete")).
+		Deprecate("1", deprecated, deprecated.AddDate(0, 1, 0))
+	v := router.Group("/v<version:[0-9]+>")
+	v.Add("/users").
+		Version("1").Get(versionTestHandler("users-v1")).
+		Version("2").Get(versionTestHandler("users-v2"))
+	router.Add("/plain").Get(versionTestHandler("plain"))
+
+	for _, tt := range versionTests {
+		r := httptest.NewRequest(tt.method, tt.url, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if tt.version != "" {
+			r.Header.Set("X-API-Version", tt.version)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s %s accept=%q version=%q, status=%d, want %d", tt.method, tt.url, tt.accept, tt.version, w.Code, tt.status)
+			continue
+		}
+		if h := w.Header().Get("Allow"); h != tt.allow {
+			t.Errorf("%s %s accept=%q version=%q, allow=%q, want %q", tt.method, tt.url, tt.accept, tt.version, h, tt.allow)
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s %s accept=%q version=%q, body=%q, want %q", tt.method, tt.url, tt.accept, tt.version, w.Body.String(), tt.body)
+		}
+		if h := w.Header().Get("Deprecation"); h != tt.deprecation {
+			t.Errorf("%s %s accept=%q version=%q, deprecation=%q, want %q", tt.method, tt.url, tt.accept, tt.version, h, tt.deprecation)
+		}
+		if h := w.Header().Get("Sunset"); h != tt.sunset {
+			t.Errorf("%s %s accept=%q version=%q, sunset=%q, want %q", tt.method, tt.url, tt.accept, tt.version, h, tt.sunset)
+		}
+	}
+}
+
+func TestVersionProduces(t *testing.T) {
+	router := New()
+	router.Versioning(VersionFromAccept("version"))
+	router.Add("/items").Produces("application/vnd.example+json").
+		Version("1").Get(versionTestHandler("v1")).
+		Version("2").Get(versionTestHandler("v2"))
+
+	r := httptest.NewRequest("GET", "/items", nil)
+	r.Header.Set("Accept", "application/vnd.example+json; version=2")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "v2 2" {
+		t.Errorf("status=%d body=%q, want %d %q", w.Code, w.Body.String(), http.StatusOK, "v2 2")
+	}
+}
+
+func TestVersionPriority(t *testing.T) {
+	router := New()
+	router.Versioning(VersionFromHeader("x-v"))
+	router.Add("/items").
+		Get(versionTestHandler("generic")).
+		Version("1").
+		Version("2").Get(versionTestHandler("v2"))
+
+	for _, tt := range []struct{ version, body string }{
+		{"", "generic 1"},
+		{"1", "generic 1"},
+		{"2", "v2 2"},
+	} {
+		r := httptest.NewRequest("GET", "/items", nil)
+		if tt.version != "" {
+			r.Header.Set("X-V", tt.version)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || w.Body.String() != tt.body {
+			t.Errorf("version=%q, status=%d body=%q, want %d %q", tt.version, w.Code, w.Body.String(), http.StatusOK, tt.body)
+		}
+		if h := w.Header().Get("Vary"); h != "X-V" {
+			t.Errorf("version=%q, vary=%q, want %q", tt.version, h, "X-V")
+		}
+	}
+}
+
+func TestDeprecateUnknownVersion(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Deprecate with unknown version did not panic")
+		}
+	}()
+	New().Add("/items").Get(versionTestHandler("items")).Deprecate("1", time.Now(), time.Time{})
+}
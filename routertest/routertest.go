@@ -0,0 +1,291 @@
+// Copyright 2013 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package routertest provides utilities for testing routes.
+package routertest // import "github.com/garyburd/web/routertest"
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/garyburd/web/router"
+	"golang.org/x/net/context"
+)
+
+// Coverage records the routes of a router exercised by tests. Declare a
+// coverage value at package level, share it between tests using the Tester
+// WithCoverage method and call Report from TestMain. Requests sent by a tester
+// with Do are recorded when the tester's handler is a *router.Router or a
+// *router.HostRouter with routers added by AddRouter. AssertRoute and
+// AssertStatus do not call handlers and are not recorded. Coverage is safe
+// for concurrent use.
+type Coverage struct {
+	router *router.Router
+	mu     sync.Mutex
+	hits   map[*router.Route]int
+}
+
+// NewCoverage creates coverage for the routes in the given router.
+func NewCoverage(r *router.Router) *Coverage {
+	return &Coverage{router: r, hits: make(map[*router.Route]int)}
+}
+
+func (c *Coverage) record(route *router.Route) {
+	c.mu.Lock()
+	c.hits[route]++
+	c.mu.Unlock()
+}
+
+// Serve records the route for the request and dispatches the request to the
+// router. Use Serve in place of the router's Serve method to record coverage
+// for a router nested in another handler such as a *router.HostRouter.
+func (c *Coverage) Serve(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if route, _, status := c.router.Resolve(r); status == http.StatusOK {
+		c.record(route)
+	}
+	c.router.Serve(ctx, w, r)
+}
+
+// Unexercised returns the routes not exercised by tests in the order that the
+// routes were added to the router.
+func (c *Coverage) Unexercised() []*router.Route {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var result []*router.Route
+	for _, route := range c.router.Routes() {
+		if c.hits[route] == 0 {
+			result = append(result, route)
+		}
+	}
+	return result
+}
+
+// Report writes a report of the routes not exercised by tests to w.
+func (c *Coverage) Report(w io.Writer) error {
+	routes := c.router.Routes()
+	unexercised := c.Unexercised()
+	if _, err := fmt.Fprintf(w, "route coverage: %d of %d routes exercised\n", len(routes)-len(unexercised), len(routes)); err != nil {
+		return err
+	}
+	for _, route := range unexercised {
+		info := route.Info()
+		name := info.Name
+		if name == "" {
+			name = "-"
+		}
+		if _, err := fmt.Fprintf(w, "  %s %s %s\n", name, info.Pattern, strings.Join(info.Methods, ",")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tester tests a request handler. The handler is typically a *router.Router
+// or a *router.HostRouter.
+type Tester struct {
+	t        testing.TB
+	handler  http.Handler
+	coverage *Coverage
+}
+
+// New creates a tester for the given handler.
+func New(t testing.TB, handler http.Handler) *Tester {
+	return &Tester{t: t, handler: handler}
+}
+
+// WithCoverage records routes exercised by the tester in c.
+func (tt *Tester) WithCoverage(c *Coverage) *Tester {
+	tt.coverage = c
+	return tt
+}
+
+func newRequest(method, rawurl string, body io.Reader) *http.Request {
+	r := httptest.NewRequest(method, rawurl, body)
+	if r.URL.Host != "" {
+		r.RequestURI = r.URL.RequestURI()
+	}
+	return r
+}
+
+// resolve resolves the request using the tester's handler or the coverage
+// router. A *router.HostRouter handler resolves the request host. If the
+// host router does not know the routes for the host, then the path is
+// resolved with the coverage router.
+func (tt *Tester) resolve(r *http.Request) (*router.Route, map[string]string, int, bool) {
+	var route *router.Route
+	var params map[string]string
+	var status int
+	switch h := tt.handler.(type) {
+	case *router.Router:
+		route, params, status = h.Resolve(r)
+	case *router.HostRouter:
+		route, params, status = h.Resolve(r)
+		if status == 0 {
+			if tt.coverage == nil {
+				return nil, nil, 0, false
+			}
+			route, params, status = tt.coverage.router.Resolve(r)
+		}
+	default:
+		if tt.coverage == nil {
+			return nil, nil, 0, false
+		}
+		route, params, status = tt.coverage.router.Resolve(r)
+	}
+	return route, params, status, true
+}
+
+// AssertRoute asserts that the router resolves the method and URL to the
+// named route with the given parameters. The handler is not called. Use an
+// absolute URL to specify the request host. The tester's handler must be a
+// *router.Router, a *router.HostRouter with routers added by AddRouter or
+// the tester must have coverage.
+func (tt *Tester) AssertRoute(method, rawurl, name string, params map[string]string) {
+	tt.t.Helper()
+	route, gotParams, status, ok := tt.resolve(newRequest(method, rawurl, nil))
+	if !ok {
+		tt.t.Fatalf("AssertRoute requires a *router.Router or coverage, have %T", tt.handler)
+	}
+	if status != http.StatusOK {
+		tt.t.Errorf("%s %s resolved with status %d, want route %q", method, rawurl, status, name)
+		return
+	}
+	if got := route.Info().Name; got != name {
+		tt.t.Errorf("%s %s resolved to route %q (%s), want %q", method, rawurl, got, route.Info().Pattern, name)
+	}
+	if params == nil {
+		params = map[string]string{}
+	}
+	if !reflect.DeepEqual(gotParams, params) {
+		tt.t.Errorf("%s %s resolved with params %v, want %v", method, rawurl, gotParams, params)
+	}
+}
+
+// AssertStatus asserts that the router resolves the method and URL with the
+// given status without calling a handler. The tester's handler must be a
+// *router.Router, a *router.HostRouter with routers added by AddRouter or
+// the tester must have coverage.
+func (tt *Tester) AssertStatus(method, rawurl string, status int) {
+	tt.t.Helper()
+	_, _, got, ok := tt.resolve(newRequest(method, rawurl, nil))
+	if !ok {
+		tt.t.Fatalf("AssertStatus requires a *router.Router or coverage, have %T", tt.handler)
+	}
+	if got != status {
+		tt.t.Errorf("%s %s resolved with status %d, want %d", method, rawurl, got, status)
+	}
+}
+
+// Request starts a request to the tester's handler.
+func (tt *Tester) Request(method, rawurl string) *Request {
+	return &Request{tt: tt, method: method, url: rawurl, header: make(http.Header)}
+}
+
+// Get starts a GET request to the tester's handler.
+func (tt *Tester) Get(rawurl string) *Request { return tt.Request("GET", rawurl) }
+
+// Post starts a POST request to the tester's handler.
+func (tt *Tester) Post(rawurl string) *Request { return tt.Request("POST", rawurl) }
+
+// Request is a request under construction.
+type Request struct {
+	tt     *Tester
+	method string
+	url    string
+	header http.Header
+	body   string
+}
+
+// Header adds a request header.
+func (r *Request) Header(key, value string) *Request {
+	r.header.Add(key, value)
+	return r
+}
+
+// Body sets the request body.
+func (r *Request) Body(body string) *Request {
+	r.body = body
+	return r
+}
+
+// Do sends the request to the tester's handler and returns the response.
+func (r *Request) Do() *Response {
+	req := newRequest(r.method, r.url, strings.NewReader(r.body))
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	if host := r.header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	if c := r.tt.coverage; c != nil {
+		// Record routes for the handlers that resolve requests. Requests
+		// dispatched through Coverage.Serve are recorded by Serve.
+		var route *router.Route
+		var status int
+		switch h := r.tt.handler.(type) {
+		case *router.Router:
+			route, _, status = h.Resolve(req)
+		case *router.HostRouter:
+			route, _, status = h.Resolve(req)
+		}
+		if route != nil && status == http.StatusOK {
+			c.record(route)
+		}
+	}
+	w := httptest.NewRecorder()
+	r.tt.handler.ServeHTTP(w, req)
+	return &Response{t: r.tt.t, desc: r.method + " " + r.url, w: w}
+}
+
+// Response is a response to check.
+type Response struct {
+	t    testing.TB
+	desc string
+	w    *httptest.ResponseRecorder
+}
+
+// Recorder returns the recorder used to capture the response.
+func (r *Response) Recorder() *httptest.ResponseRecorder { return r.w }
+
+// Status checks the response status.
+func (r *Response) Status(status int) *Response {
+	r.t.Helper()
+	if r.w.Code != status {
+		r.t.Errorf("%s: status=%d, want %d", r.desc, r.w.Code, status)
+	}
+	return r
+}
+
+// Header checks the value of a response header.
+func (r *Response) Header(key, value string) *Response {
+	r.t.Helper()
+	if got := r.w.Header().Get(key); got != value {
+		r.t.Errorf("%s: header %s=%q, want %q", r.desc, key, got, value)
+	}
+	return r
+}
+
+// Body checks the response body.
+func (r *Response) Body(body string) *Response {
+	r.t.Helper()
+	if got := r.w.Body.String(); got != body {
+		r.t.Errorf("%s: body=%q, want %q", r.desc, got, body)
+	}
+	return r
+}
+
+// BodyContains checks that the response body contains s.
+func (r *Response) BodyContains(s string) *Response {
+	r.t.Helper()
+	if got := r.w.Body.String(); !strings.Contains(got, s) {
+		r.t.Errorf("%s: body=%q does not contain %q", r.desc, got, s)
+	}
+	return r
+}
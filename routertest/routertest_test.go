@@ -0,0 +1,99 @@
+// Copyright 2013 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package routertest
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/garyburd/web/router"
+	"golang.org/x/net/context"
+)
+
+func textHandler(s string) router.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(s))
+	}
+}
+
+func newTestRouter() *router.Router {
+	r := router.New()
+	r.Add("/").Name("home").Get(textHandler("home"))
+	r.Add("/users/<id:[0-9]+>").Name("user").Get(textHandler("user"))
+	r.Add("/posts/<slug>/").Name("post").Get(textHandler("post")).Post(textHandler("post-post"))
+	r.Add("/admin").Name("admin").Get(textHandler("admin"))
+	return r
+}
+
+func TestAssertRoute(t *testing.T) {
+	tt := New(t, newTestRouter())
+	tt.AssertRoute("GET", "/", "home", nil)
+	tt.AssertRoute("GET", "/users/42", "user", map[string]string{"id": "42"})
+	tt.AssertRoute("POST", "/posts/hello%20world/", "post", map[string]string{"slug": "hello world"})
+	tt.AssertStatus("GET", "/users/bob", http.StatusNotFound)
+	tt.AssertStatus("POST", "/users/42", http.StatusMethodNotAllowed)
+	tt.AssertStatus("GET", "/posts/hello", http.StatusMovedPermanently)
+	tt.AssertStatus("GET", "/a/../users/42", http.StatusMovedPermanently)
+}
+
+func TestRequest(t *testing.T) {
+	tt := New(t, newTestRouter())
+	tt.Get("/users/42").Do().Status(http.StatusOK).Header("Content-Type", "text/plain").Body("user")
+	tt.Post("/posts/x/").Body("hello").Do().Status(http.StatusOK).BodyContains("post")
+	tt.Get("/nope").Do().Status(http.StatusNotFound)
+}
+
+func TestHostRouter(t *testing.T) {
+	r := newTestRouter()
+	c := NewCoverage(r)
+	hr := router.NewHostRouter()
+	hr.Add("www.example.com", c.Serve)
+	tt := New(t, hr).WithCoverage(c)
+	tt.Get("http://www.example.com/users/1").Do().Status(http.StatusOK).Body("user")
+	tt.Get("/").Header("Host", "other.example.com").Do().Status(http.StatusNotFound)
+	tt.AssertRoute("GET", "http://www.example.com/admin", "admin", nil)
+	tt.AssertStatus("GET", "http://other.example.com/admin", http.StatusNotFound)
+	if n := len(c.Unexercised()); n != 3 {
+		t.Errorf("len(Unexercised()) = %d, want 3", n)
+	}
+}
+
+func TestHostRouterRoutes(t *testing.T) {
+	api := router.New()
+	api.Add("/users/<id>").Name("api-user").Get(textHandler("api-user"))
+	hr := router.NewHostRouter()
+	hr.AddRouter("www.example.com", newTestRouter())
+	hr.AddRouter("api.example.com", api)
+	tt := New(t, hr)
+	tt.AssertRoute("GET", "http://www.example.com/users/42", "user", map[string]string{"id": "42"})
+	tt.AssertRoute("GET", "http://api.example.com/users/42", "api-user", map[string]string{"id": "42"})
+	tt.AssertStatus("GET", "http://api.example.com/admin", http.StatusNotFound)
+	tt.AssertStatus("GET", "http://www.example.com:8080/admin", http.StatusOK)
+	tt.AssertStatus("GET", "http://other.example.com/", http.StatusNotFound)
+	tt.Get("http://api.example.com/users/1").Do().Status(http.StatusOK).Body("api-user")
+}
+
+func TestCoverage(t *testing.T) {
+	r := newTestRouter()
+	c := NewCoverage(r)
+	tt := New(t, r).WithCoverage(c)
+	tt.AssertRoute("GET", "/", "home", nil)
+	tt.Get("/posts/x/").Do().Status(http.StatusOK)
+	tt.AssertStatus("POST", "/admin", http.StatusMethodNotAllowed)
+
+	var buf bytes.Buffer
+	if err := c.Report(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "route coverage: 1 of 4 routes exercised\n" +
+		"  home / GET\n" +
+		"  user /users/<id:[0-9]+> GET\n" +
+		"  admin /admin GET\n"
+	if buf.String() != want {
+		t.Errorf("report=\n%s\nwant\n%s", buf.String(), want)
+	}
+}
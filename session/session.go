@@ -0,0 +1,303 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package session implements server-side sessions.
+//
+// The session ID is stored in a cookie encoded by a cookie.Codec. Configure
+// the codec with HMAC or encryption keys to protect the ID. The session data
+// is stored in a Store.
+//
+// The manager writes the session cookie only when the session ID changes and
+// writes the session data to the store only when the data changes or when
+// the idle timeout must be extended.
+package session // import "github.com/garyburd/web/session"
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/garyburd/web/cookie"
+	"golang.org/x/net/context"
+)
+
+// now is a hook for tests.
+var now = time.Now
+
+// ErrNotFound is returned by Store Load when the session is not found or has
+// expired.
+var ErrNotFound = errors.New("session: not found")
+
+// Store loads and saves session data.
+type Store interface {
+	// Load returns the data for the session with the given ID. Load returns
+	// ErrNotFound if the session does not exist or has expired.
+	Load(ctx context.Context, id string) ([]byte, error)
+
+	// Save saves the data for the session with the given ID. The store can
+	// delete the session after the expiration time.
+	Save(ctx context.Context, id string, data []byte, expires time.Time) error
+
+	// Delete deletes the session with the given ID. Delete does not return an
+	// error if the session does not exist.
+	Delete(ctx context.Context, id string) error
+}
+
+// Manager loads and saves sessions.
+type Manager struct {
+	codec           *cookie.Codec
+	store           Store
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+}
+
+// Option specifies an option for a manager.
+type Option struct {
+	f func(*Manager)
+}
+
+// NewManager returns a new manager that stores the session ID using codec
+// and the session data in store. The default idle timeout is 30 minutes and
+// the default absolute timeout is 24 hours.
+func NewManager(codec *cookie.Codec, store Store, options ...Option) *Manager {
+	m := &Manager{
+		codec:           codec,
+		store:           store,
+		idleTimeout:     30 * time.Minute,
+		absoluteTimeout: 24 * time.Hour,
+	}
+	for _, option := range options {
+		option.f(m)
+	}
+	if m.idleTimeout <= 0 || m.absoluteTimeout <= 0 {
+		panic("session: timeouts must be greater than zero")
+	}
+	return m
+}
+
+// WithIdleTimeout specifies the time that a session expires after the last
+// request using the session.
+func WithIdleTimeout(d time.Duration) Option {
+	return Option{func(m *Manager) { m.idleTimeout = d }}
+}
+
+// WithAbsoluteTimeout specifies the time that a session expires after the
+// session is created or the session ID is regenerated.
+func WithAbsoluteTimeout(d time.Duration) Option {
+	return Option{func(m *Manager) { m.absoluteTimeout = d }}
+}
+
+// Session represents a session.
+type Session struct {
+	id         string
+	values     map[string]string
+	created    time.Time
+	accessed   time.Time
+	changed    bool
+	regenerate bool
+	destroyed  bool
+	hasCookie  bool
+}
+
+// record is the format of session data in the store.
+type record struct {
+	Values   map[string]string `json:"v,omitempty"`
+	Created  int64             `json:"c"`
+	Accessed int64             `json:"a"`
+}
+
+// ID returns the session ID or "" if the session has not been saved.
+func (s *Session) ID() string { return s.id }
+
+// IsNew returns true if the session was not loaded from the store.
+func (s *Session) IsNew() bool { return s.created.IsZero() }
+
+// Get returns the value for key.
+func (s *Session) Get(key string) (string, bool) {
+	v, ok := s.values[key]
+	return v, ok
+}
+
+// Set sets the value for key.
+func (s *Session) Set(key, value string) {
+	if v, ok := s.values[key]; ok && v == value {
+		return
+	}
+	s.values[key] = value
+	s.changed = true
+}
+
+// Delete deletes the value for key.
+func (s *Session) Delete(key string) {
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.changed = true
+	}
+}
+
+// Keys returns the sorted keys in the session.
+func (s *Session) Keys() []string {
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Regenerate replaces the session ID with a new ID when the session is saved
+// and restarts the absolute timeout. Call Regenerate when the privilege level
+// of the session changes, for example after the user logs in or out, to
+// prevent session fixation.
+func (s *Session) Regenerate() {
+	s.regenerate = true
+	s.changed = true
+}
+
+// Destroy deletes the session data and the session cookie when the session is
+// saved.
+func (s *Session) Destroy() {
+	s.destroyed = true
+	s.values = make(map[string]string)
+}
+
+type sessionKey struct{}
+
+// NewContext returns a new context with the session. Middleware that loads
+// the session stores the session in the context so that handlers use the same
+// session.
+func NewContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// FromContext returns the session stored in the context by NewContext.
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionKey{}).(*Session)
+	return s, ok
+}
+
+// Get returns the session for the request. If the request does not have a
+// valid session cookie or the session has expired, then Get returns a new
+// session. Errors from the store are returned to the caller.
+func (m *Manager) Get(ctx context.Context, r *http.Request) (*Session, error) {
+	s := &Session{values: make(map[string]string)}
+	var id string
+	if err := m.codec.Decode(r, &id); err != nil || id == "" {
+		return s, nil
+	}
+	s.hasCookie = true
+	data, err := m.store.Load(ctx, id)
+	if err == ErrNotFound {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return s, m.store.Delete(ctx, id)
+	}
+	created := time.Unix(rec.Created, 0)
+	accessed := time.Unix(rec.Accessed, 0)
+	t := now()
+	if !t.Before(created.Add(m.absoluteTimeout)) || !t.Before(accessed.Add(m.idleTimeout)) {
+		return s, m.store.Delete(ctx, id)
+	}
+	s.id = id
+	s.created = created
+	s.accessed = accessed
+	if rec.Values != nil {
+		s.values = rec.Values
+	}
+	return s, nil
+}
+
+func newID() (string, error) {
+	var p [24]byte
+	if _, err := rand.Read(p[:]); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(p[:]), nil
+}
+
+// Save saves the session. Call Save before writing the response body.
+//
+// Save writes the session cookie when the session ID is created, regenerated
+// or destroyed. Save does not create a session in the store until a value is
+// set in the session.
+func (m *Manager) Save(ctx context.Context, w http.ResponseWriter, s *Session) error {
+	if s.destroyed {
+		if s.id != "" {
+			if err := m.store.Delete(ctx, s.id); err != nil {
+				return err
+			}
+			s.id = ""
+		}
+		s.created = time.Time{}
+		s.destroyed = false
+		s.regenerate = false
+		s.changed = false
+		if s.hasCookie {
+			s.hasCookie = false
+			return m.codec.Encode(w)
+		}
+		return nil
+	}
+
+	t := now()
+	writeCookie := false
+
+	if s.regenerate && s.id != "" {
+		if err := m.store.Delete(ctx, s.id); err != nil {
+			return err
+		}
+		s.id = ""
+		s.created = time.Time{}
+	}
+	s.regenerate = false
+
+	if s.id == "" {
+		if !s.changed {
+			return nil
+		}
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		s.id = id
+		s.created = t
+		writeCookie = true
+	}
+
+	// Extend the idle timeout after a tenth of the timeout has elapsed to
+	// avoid writing to the store on every request.
+	if s.changed || writeCookie || t.Sub(s.accessed) >= m.idleTimeout/10 {
+		s.accessed = t
+		data, err := json.Marshal(&record{
+			Values:   s.values,
+			Created:  s.created.Unix(),
+			Accessed: s.accessed.Unix(),
+		})
+		if err != nil {
+			return err
+		}
+		expires := s.accessed.Add(m.idleTimeout)
+		if abs := s.created.Add(m.absoluteTimeout); abs.Before(expires) {
+			expires = abs
+		}
+		if err := m.store.Save(ctx, s.id, data, expires); err != nil {
+			return err
+		}
+		s.changed = false
+	}
+
+	if writeCookie {
+		s.hasCookie = true
+		return m.codec.Encode(w, s.id)
+	}
+	return nil
+}
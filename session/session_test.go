@@ -0,0 +1,174 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garyburd/web/cookie"
+	"golang.org/x/net/context"
+)
+
+var testTime = time.Unix(1136214245, 0)
+
+// client holds the session cookie between requests.
+type client struct {
+	t      *testing.T
+	m      *Manager
+	cookie string
+}
+
+// do calls fn with the session for a request and saves the session. The
+// Set-Cookie header from the response is returned.
+func (c *client) do(fn func(s *Session)) string {
+	ctx := context.Background()
+	r, _ := http.NewRequest("GET", "/", nil)
+	if c.cookie != "" {
+		r.Header.Set("Cookie", c.cookie)
+	}
+	s, err := c.m.Get(ctx, r)
+	if err != nil {
+		c.t.Fatalf("Get returned error %v", err)
+	}
+	fn(s)
+	w := httptest.NewRecorder()
+	if err := c.m.Save(ctx, w, s); err != nil {
+		c.t.Fatalf("Save returned error %v", err)
+	}
+	setCookie := w.Header().Get("Set-Cookie")
+	if setCookie != "" {
+		c.cookie = setCookie[:strings.Index(setCookie, ";")]
+		if strings.Contains(setCookie, "max-age=-") {
+			c.cookie = ""
+		}
+	}
+	return setCookie
+}
+
+func newTestManager(store Store) *Manager {
+	codec := cookie.NewCodec("session", cookie.WithHMACKeys([][]byte{[]byte("key")}))
+	return NewManager(codec, store, WithIdleTimeout(10*time.Minute), WithAbsoluteTimeout(time.Hour))
+}
+
+func TestSession(t *testing.T) {
+	t0 := testTime
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+
+	store := NewMemoryStore()
+	c := &client{t: t, m: newTestManager(store)}
+
+	// A session without values is not saved.
+	if sc := c.do(func(s *Session) {}); sc != "" {
+		t.Fatalf("empty session wrote cookie %q", sc)
+	}
+	if len(store.entries) != 0 {
+		t.Fatalf("empty session saved to store")
+	}
+
+	if sc := c.do(func(s *Session) { s.Set("user", "bob") }); sc == "" {
+		t.Fatal("new session did not write cookie")
+	}
+	var id string
+	c.do(func(s *Session) {
+		id = s.ID()
+		if s.IsNew() {
+			t.Error("loaded session is new")
+		}
+		if v, _ := s.Get("user"); v != "bob" {
+			t.Errorf("Get(user) = %q, want bob", v)
+		}
+	})
+
+	// Changing a value does not write the cookie.
+	if sc := c.do(func(s *Session) { s.Set("theme", "dark") }); sc != "" {
+		t.Errorf("changed session wrote cookie %q", sc)
+	}
+
+	// Regenerate changes the ID, keeps the values and deletes the old session.
+	if sc := c.do(func(s *Session) { s.Regenerate() }); sc == "" {
+		t.Error("regenerated session did not write cookie")
+	}
+	c.do(func(s *Session) {
+		if s.ID() == id {
+			t.Error("regenerated session has old ID")
+		}
+		if v, _ := s.Get("theme"); v != "dark" {
+			t.Errorf("Get(theme) = %q, want dark", v)
+		}
+	})
+	if _, err := store.Load(context.Background(), id); err != ErrNotFound {
+		t.Errorf("old session not deleted, err = %v", err)
+	}
+
+	// Destroy deletes the cookie.
+	if sc := c.do(func(s *Session) { s.Destroy() }); !strings.Contains(sc, "max-age=-") {
+		t.Errorf("destroyed session cookie = %q, want delete", sc)
+	}
+	if len(store.entries) != 0 {
+		t.Errorf("destroyed session not deleted from store")
+	}
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	t0 := testTime
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+
+	c := &client{t: t, m: newTestManager(NewMemoryStore())}
+	c.do(func(s *Session) { s.Set("user", "bob") })
+
+	// Requests within the idle timeout extend the session.
+	for i := 0; i < 6; i++ {
+		t0 = t0.Add(9 * time.Minute)
+		c.do(func(s *Session) {
+			if s.IsNew() {
+				t.Fatalf("session expired after %v", t0.Sub(testTime))
+			}
+		})
+	}
+
+	// The absolute timeout expires the session.
+	t0 = t0.Add(9 * time.Minute)
+	c.do(func(s *Session) {
+		if !s.IsNew() {
+			t.Errorf("session not expired after %v", t0.Sub(testTime))
+		}
+	})
+
+	// The idle timeout expires the session.
+	c.do(func(s *Session) { s.Set("user", "bob") })
+	t0 = t0.Add(11 * time.Minute)
+	c.do(func(s *Session) {
+		if !s.IsNew() {
+			t.Error("session not expired after idle timeout")
+		}
+	})
+}
+
+func TestSessionRejectsUnknownID(t *testing.T) {
+	m := newTestManager(NewMemoryStore())
+	c := &client{t: t, m: m}
+	c.do(func(s *Session) { s.Set("user", "bob") })
+
+	// Forge a valid cookie for an ID not in the store.
+	w := httptest.NewRecorder()
+	m.codec.Encode(w, "attacker-chosen")
+	sc := w.Header().Get("Set-Cookie")
+	c.cookie = sc[:strings.Index(sc, ";")]
+	c.do(func(s *Session) {
+		if !s.IsNew() || s.ID() != "" {
+			t.Errorf("unknown session ID accepted")
+		}
+		s.Set("user", "eve")
+	})
+	if strings.Contains(c.cookie, "attacker-chosen") {
+		t.Errorf("unknown session ID reused")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package session
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/garyburd/web/sqlutil"
+	"golang.org/x/net/context"
+)
+
+// SQLStore stores sessions in a database table with the following columns:
+//
+//	id       text primary key
+//	data     blob
+//	expires  integer, expiration time in Unix seconds
+//
+// The column types depend on the database. Expired sessions are deleted when
+// loaded and by the DeleteExpired method.
+type SQLStore struct {
+	db      *sql.DB
+	sc      *sqlutil.Context
+	load    string
+	insert  string
+	delete  string
+	expired string
+}
+
+type sqlRecord struct {
+	Data    []byte `sql:"data"`
+	Expires int64  `sql:"expires"`
+}
+
+// NewSQLStore returns a new SQL store using the given database and table.
+// The function placeholder returns the query parameter placeholder for the
+// argument with index i, starting at 1. If placeholder is nil, then "?" is
+// used. Use a function returning "$" + strconv.Itoa(i) for PostgreSQL.
+func NewSQLStore(db *sql.DB, table string, placeholder func(i int) string) *SQLStore {
+	if placeholder == nil {
+		placeholder = func(i int) string { return "?" }
+	}
+	p1, p2, p3 := placeholder(1), placeholder(2), placeholder(3)
+	return &SQLStore{
+		db:      db,
+		sc:      &sqlutil.Context{MapName: strings.ToLower},
+		load:    fmt.Sprintf("SELECT data, expires FROM %s WHERE id = %s", table, p1),
+		insert:  fmt.Sprintf("INSERT INTO %s (data, expires, id) VALUES (%s, %s, %s)", table, p1, p2, p3),
+		delete:  fmt.Sprintf("DELETE FROM %s WHERE id = %s", table, p1),
+		expired: fmt.Sprintf("DELETE FROM %s WHERE expires <= %s", table, p1),
+	}
+}
+
+// Load implements the Store interface.
+func (ss *SQLStore) Load(ctx context.Context, id string) ([]byte, error) {
+	rows, err := ss.db.QueryContext(ctx, ss.load, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rec sqlRecord
+	err = ss.sc.ScanRow(rows, &rec)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if now().Unix() >= rec.Expires {
+		rows.Close()
+		if err := ss.Delete(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+	return rec.Data, nil
+}
+
+// Save implements the Store interface. The session is replaced by deleting
+// and inserting the row in a transaction.
+func (ss *SQLStore) Save(ctx context.Context, id string, data []byte, expires time.Time) error {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, ss.delete, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, ss.insert, data, expires.Unix(), id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete implements the Store interface.
+func (ss *SQLStore) Delete(ctx context.Context, id string) error {
+	_, err := ss.db.ExecContext(ctx, ss.delete, id)
+	return err
+}
+
+// DeleteExpired deletes expired sessions.
+func (ss *SQLStore) DeleteExpired(ctx context.Context) error {
+	_, err := ss.db.ExecContext(ctx, ss.expired, now().Unix())
+	return err
+}
@@ -0,0 +1,204 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package session
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type memoryEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// MemoryStore stores sessions in memory. Expired sessions are deleted when
+// loaded and by the DeleteExpired method.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// NewMemoryStore returns a new memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+// Load implements the Store interface.
+func (ms *MemoryStore) Load(ctx context.Context, id string) ([]byte, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	e, ok := ms.entries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !now().Before(e.expires) {
+		delete(ms.entries, id)
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), e.data...), nil
+}
+
+// Save implements the Store interface.
+func (ms *MemoryStore) Save(ctx context.Context, id string, data []byte, expires time.Time) error {
+	ms.mu.Lock()
+	ms.entries[id] = memoryEntry{data: append([]byte(nil), data...), expires: expires}
+	ms.mu.Unlock()
+	return nil
+}
+
+// Delete implements the Store interface.
+func (ms *MemoryStore) Delete(ctx context.Context, id string) error {
+	ms.mu.Lock()
+	delete(ms.entries, id)
+	ms.mu.Unlock()
+	return nil
+}
+
+// DeleteExpired deletes expired sessions.
+func (ms *MemoryStore) DeleteExpired() {
+	t := now()
+	ms.mu.Lock()
+	for id, e := range ms.entries {
+		if !t.Before(e.expires) {
+			delete(ms.entries, id)
+		}
+	}
+	ms.mu.Unlock()
+}
+
+// FileStore stores each session in a file in a directory. The first line of
+// the file is the expiration time in Unix seconds. The remainder of the file
+// is the session data.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a new file store using the directory dir. The
+// directory must exist.
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+var errBadID = errors.New("session: bad session ID")
+
+func (fs *FileStore) path(id string) (string, error) {
+	if id == "" {
+		return "", errBadID
+	}
+	for i := 0; i < len(id); i++ {
+		b := id[i]
+		if !('a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b == '-' || b == '_') {
+			return "", errBadID
+		}
+	}
+	return filepath.Join(fs.dir, "session_"+id), nil
+}
+
+// readFile returns the expiration time and data from a session file.
+func readFile(name string) (time.Time, []byte, error) {
+	p, err := ioutil.ReadFile(name)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	i := bytes.IndexByte(p, '\n')
+	if i < 0 {
+		return time.Time{}, nil, errors.New("session: bad file format")
+	}
+	t, err := strconv.ParseInt(string(p[:i]), 10, 64)
+	if err != nil {
+		return time.Time{}, nil, errors.New("session: bad file format")
+	}
+	return time.Unix(t, 0), p[i+1:], nil
+}
+
+// Load implements the Store interface.
+func (fs *FileStore) Load(ctx context.Context, id string) ([]byte, error) {
+	name, err := fs.path(id)
+	if err == errBadID {
+		return nil, ErrNotFound
+	}
+	expires, data, err := readFile(name)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if !now().Before(expires) {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// Save implements the Store interface. The file is written to a temporary
+// file and renamed to prevent readers from seeing a partial file.
+func (fs *FileStore) Save(ctx context.Context, id string, data []byte, expires time.Time) error {
+	name, err := fs.path(id)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(fs.dir, "tmp_")
+	if err != nil {
+		return err
+	}
+	p := strconv.AppendInt(nil, expires.Unix(), 10)
+	p = append(p, '\n')
+	p = append(p, data...)
+	_, err = f.Write(p)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Delete implements the Store interface.
+func (fs *FileStore) Delete(ctx context.Context, id string) error {
+	name, err := fs.path(id)
+	if err == errBadID {
+		return nil
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// DeleteExpired deletes expired sessions.
+func (fs *FileStore) DeleteExpired() error {
+	names, err := filepath.Glob(filepath.Join(fs.dir, "session_*"))
+	if err != nil {
+		return err
+	}
+	t := now()
+	for _, name := range names {
+		expires, _, err := readFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil || !t.Before(expires) {
+			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2014 Gary Burd. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package session
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func testStore(t *testing.T, store Store, deleteExpired func() error) {
+	t0 := testTime
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+	ctx := context.Background()
+
+	if _, err := store.Load(ctx, "a"); err != ErrNotFound {
+		t.Fatalf("Load(a) returned %v, want ErrNotFound", err)
+	}
+	if err := store.Save(ctx, "a", []byte("hello"), t0.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, "a", []byte("world"), t0.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, "b", []byte("b"), t0.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := store.Load(ctx, "a"); err != nil || string(data) != "world" {
+		t.Fatalf("Load(a) = %q, %v, want world", data, err)
+	}
+
+	t0 = t0.Add(time.Minute)
+	if _, err := store.Load(ctx, "a"); err != ErrNotFound {
+		t.Fatalf("Load(a) of expired session returned %v, want ErrNotFound", err)
+	}
+
+	t0 = t0.Add(time.Minute)
+	if err := deleteExpired(); err != nil {
+		t.Fatal(err)
+	}
+	now = time.Now
+	if _, err := store.Load(ctx, "b"); err != ErrNotFound {
+		t.Fatalf("Load(b) after DeleteExpired returned %v, want ErrNotFound", err)
+	}
+
+	if err := store.Save(ctx, "c", []byte("c"), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(ctx, "c"); err != ErrNotFound {
+		t.Fatalf("Load(c) after Delete returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	testStore(t, store, func() error { store.DeleteExpired(); return nil })
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewFileStore(dir)
+	testStore(t, store, store.DeleteExpired)
+
+	if err := store.Save(context.Background(), "../x", nil, time.Now().Add(time.Minute)); err == nil {
+		t.Error("Save with bad ID did not return error")
+	}
+}